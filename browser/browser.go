@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"encoding/base64"
 	"encoding/hex"
 	"fmt"
 	"io"
@@ -24,6 +25,7 @@ import (
 type pendingResponse struct {
 	id      string
 	request *http.Request
+	network *modifier.NetworkConditions // the network rule applied, nil for none
 }
 
 type tabCapture struct {
@@ -273,8 +275,10 @@ func (t *tabCapture) handleRequest(ev *fetch.EventRequestPaused) {
 		return
 	}
 
+	nc, _ := modifier.MatchNetwork(req.URL)
+
 	t.mu.Lock()
-	t.pending[ev.RequestID] = &pendingResponse{id: id, request: req}
+	t.pending[ev.RequestID] = &pendingResponse{id: id, request: req, network: nc}
 	t.mu.Unlock()
 
 	err = t.logger.InjectRequest(id, req, modifier.SourceBrowser)
@@ -283,9 +287,64 @@ func (t *tabCapture) handleRequest(ev *fetch.EventRequestPaused) {
 		log.Printf("[!] Browser - InjectRequest: %s\n", err)
 	}
 
+	if nc != nil {
+		go t.networkRequest(ev, id, nc)
+		return
+	}
+
 	go t.continueReq(ev, true)
 }
 
+// networkRequest - apply a network rule to a paused request. After the rule's latency the
+// request is failed with a reset, answered with an injected error, or sent on
+func (t *tabCapture) networkRequest(ev *fetch.EventRequestPaused, id string, nc *modifier.NetworkConditions) {
+	time.Sleep(nc.Latency)
+
+	if nc.Fault == "" {
+		t.continueReq(ev, true)
+		return
+	}
+
+	t.mu.Lock()
+	delete(t.pending, ev.RequestID)
+	t.mu.Unlock()
+
+	t.logger.SetFault(id, nc.Fault)
+
+	if nc.Reset {
+		if err := chromedp.Run(t.ctx, fetch.FailRequest(ev.RequestID, network.ErrorReasonConnectionReset)); err != nil {
+			log.Printf("[!] Browser - FailRequest: %s %s\n", ev.Request.URL, err)
+		}
+		return
+	}
+
+	body := []byte(http.StatusText(nc.Status) + "\n")
+	headers := []*fetch.HeaderEntry{{Name: "Content-Type", Value: "text/plain; charset=utf-8"}}
+	t.fulfill(ev, int64(nc.Status), headers, body)
+
+	resp := &http.Response{
+		StatusCode:    nc.Status,
+		Status:        http.StatusText(nc.Status),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Header:        http.Header{"Content-Type": {headers[0].Value}},
+	}
+	if err := t.logger.InjectResponse(id, resp); err != nil {
+		log.Printf("[!] Browser - InjectResponse: %s\n", err)
+	}
+}
+
+// fulfill - answer a paused request with the given response instead of the server's
+func (t *tabCapture) fulfill(ev *fetch.EventRequestPaused, status int64, headers []*fetch.HeaderEntry, body []byte) {
+	err := chromedp.Run(t.ctx, fetch.FulfillRequest(ev.RequestID, status).
+		WithResponseHeaders(headers).
+		WithBody(base64.StdEncoding.EncodeToString(body)))
+
+	if err != nil {
+		log.Printf("[!] Browser - FulfillRequest: %s %s\n", ev.Request.URL, err)
+	}
+}
+
 func (t *tabCapture) handleResponse(ev *fetch.EventRequestPaused) {
 	t.mu.Lock()
 	pend, ok := t.pending[ev.RequestID]
@@ -320,6 +379,16 @@ func (t *tabCapture) handleResponse(ev *fetch.EventRequestPaused) {
 			}
 		}
 
+		// the response is held back for as long as it would take at the capped bandwidth
+		nc := pend.network
+		if nc != nil {
+			nc.Throttle(len(body))
+			if nc.Truncate {
+				body = nc.Cut(body)
+				t.logger.SetFault(pend.id, nc.Fault)
+			}
+		}
+
 		resp, err := buildFetchResponse(ev, body)
 		if err != nil {
 			log.Printf("[!] Browser - buildFetchResponse: %s\n", err)
@@ -332,10 +401,29 @@ func (t *tabCapture) handleResponse(ev *fetch.EventRequestPaused) {
 			log.Printf("[!] Browser - InjectResponse: %s\n", err)
 		}
 
+		if nc != nil && nc.Fault != "" {
+			go t.fulfill(ev, ev.ResponseStatusCode, bodyHeaders(ev.ResponseHeaders), body)
+			return
+		}
+
 		go t.continueResp(ev)
 	}()
 }
 
+// bodyHeaders - response headers without the ones describing the original body, for
+// fulfilling a request with a changed body
+func bodyHeaders(headers []*fetch.HeaderEntry) []*fetch.HeaderEntry {
+	var kept []*fetch.HeaderEntry
+	for _, h := range headers {
+		switch strings.ToLower(h.Name) {
+		case "content-length", "content-encoding", "transfer-encoding":
+			continue
+		}
+		kept = append(kept, h)
+	}
+	return kept
+}
+
 func parseProtocol(proto string) (major, minor int, display string) {
 	switch proto {
 	case "h2":
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/denandz/glorp/proxy"
+)
+
+// caCommand - the "glorp ca" subcommand, shows, regenerates or exports the CA the
+// proxy uses when it isn't given -cert and -key
+func caCommand(args []string) {
+	fs := flag.NewFlagSet("ca", flag.ExitOnError)
+	dir := fs.String("dir", "", "Directory the CA is kept in, defaults to the user config directory")
+	regenerate := fs.Bool("new", false, "Generate a new CA, replacing the existing one")
+	name := fs.String("name", "Glorp CA", "Common name for a newly generated CA")
+	days := fs.Int("days", 1825, "Validity in days for a newly generated CA")
+	export := fs.String("export", "", "Write the CA certificate to this file, - for stdout")
+	format := fs.String("format", "pem", "Export format, pem or der")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage of %s ca:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *format != "pem" && *format != "der" {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	if *dir == "" {
+		d, err := proxy.DefaultCADir()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		*dir = d
+	}
+
+	if *regenerate {
+		cert, priv, err := proxy.GenerateCA(*name, time.Duration(*days)*24*time.Hour)
+		if err == nil {
+			err = proxy.WriteCA(*dir, cert, priv)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	cert, _, err := proxy.LoadOrCreateCA(*dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *export != "" {
+		data := proxy.CertPEM(cert)
+		if *format == "der" {
+			data = cert.Raw
+		}
+
+		if *export == "-" {
+			os.Stdout.Write(data)
+			return
+		}
+		if err := os.WriteFile(*export, data, 0644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Certificate: %s\n", filepath.Join(*dir, proxy.CACertFile))
+	fmt.Fprintf(os.Stderr, "Key:         %s\n", filepath.Join(*dir, proxy.CAKeyFile))
+	fmt.Fprintf(os.Stderr, "Subject:     %s\n", cert.Subject)
+	fmt.Fprintf(os.Stderr, "Expires:     %s\n", cert.NotAfter.Format(time.RFC3339))
+	fmt.Fprintf(os.Stderr, "SHA256:      %s\n", proxy.CertFingerprint(cert))
+}
@@ -0,0 +1,172 @@
+// Package dialer - the connection dialer shared by the proxy and the replayer, it applies
+// the hostname overrides so traffic for a name can be sent to a chosen IP without
+// editing the system hosts file, the routing rules that pick an upstream proxy per
+// destination, and the optional upstream certificate verification
+package dialer
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Override - send connections for hostnames matching Pattern to IP. Patterns are
+// hostnames, optionally with shell style wildcards such as *.staging.example.com
+type Override struct {
+	Pattern string
+	IP      string
+}
+
+// Overrides - a table of hostname overrides, safe to edit while connections are dialled
+type Overrides struct {
+	mu        sync.RWMutex
+	overrides []Override
+}
+
+// Hosts - the overrides used by Dial and DialContext
+var Hosts = new(Overrides)
+
+// Set - add an override, replacing any existing one for the same pattern
+func (o *Overrides) Set(pattern, ip string) error {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	ip = strings.TrimSpace(ip)
+
+	if pattern == "" {
+		return errors.New("empty hostname")
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return errors.New("bad hostname pattern " + pattern)
+	}
+	if net.ParseIP(ip) == nil {
+		return errors.New("bad IP address " + ip)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for i := range o.overrides {
+		if o.overrides[i].Pattern == pattern {
+			o.overrides[i].IP = ip
+			return nil
+		}
+	}
+	o.overrides = append(o.overrides, Override{Pattern: pattern, IP: ip})
+	return nil
+}
+
+// Remove - remove the override for pattern
+func (o *Overrides) Remove(pattern string) {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for i := range o.overrides {
+		if o.overrides[i].Pattern == pattern {
+			o.overrides = append(o.overrides[:i], o.overrides[i+1:]...)
+			return
+		}
+	}
+}
+
+// List - the current overrides, in the order they were added
+func (o *Overrides) List() []Override {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	return append([]Override(nil), o.overrides...)
+}
+
+// Lookup - the IP for host. Exact patterns win over wildcards, otherwise the first
+// matching override does
+func (o *Overrides) Lookup(host string) (string, bool) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	for _, v := range o.overrides {
+		if v.Pattern == host {
+			return v.IP, true
+		}
+	}
+
+	for _, v := range o.overrides {
+		if ok, _ := path.Match(v.Pattern, host); ok {
+			return v.IP, true
+		}
+	}
+
+	return "", false
+}
+
+// LoadHostsFile - add the entries of a file in the /etc/hosts format, IP address
+// followed by one or more hostnames
+func (o *Overrides) LoadHostsFile(name string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		for _, host := range fields[1:] {
+			if err := o.Set(host, fields[0]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return scanner.Err()
+}
+
+var netDialer = &net.Dialer{
+	Timeout:   30 * time.Second,
+	KeepAlive: 30 * time.Second,
+}
+
+// Dial - connect to addr, swapping the hostname for its override if there is one
+func Dial(network, addr string) (net.Conn, error) {
+	return DialContext(context.Background(), network, addr)
+}
+
+// DialContext - connect to addr, swapping the hostname for its override if there is one
+func DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return netDialer.DialContext(ctx, network, Resolve(addr))
+}
+
+// Direct - dials with Dial, for APIs that take a dialer such as golang.org/x/net/proxy
+var Direct direct
+
+type direct struct{}
+
+func (direct) Dial(network, addr string) (net.Conn, error) {
+	return Dial(network, addr)
+}
+
+// Resolve - addr with its hostname replaced by the override's IP, or addr unchanged
+// when there's no override
+func Resolve(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	if ip, ok := Hosts.Lookup(host); ok {
+		return net.JoinHostPort(ip, port)
+	}
+	return addr
+}
@@ -0,0 +1,136 @@
+package dialer
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLookup(t *testing.T) {
+	o := new(Overrides)
+	o.Set("*.example.com", "10.0.0.1")
+	o.Set("api.example.com", "10.0.0.2")
+
+	tests := []struct {
+		host string
+		want string
+		ok   bool
+	}{
+		{"api.example.com", "10.0.0.2", true},
+		{"API.example.com.", "10.0.0.2", true},
+		{"www.example.com", "10.0.0.1", true},
+		{"example.com", "", false},
+		{"example.org", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := o.Lookup(tt.host)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Lookup(%s) got %v %v want %v %v", tt.host, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	if err := o.Set("bad.example.com", "not an ip"); err == nil {
+		t.Errorf("Set with a bad IP got nil want error")
+	}
+}
+
+func TestRoutesProxy(t *testing.T) {
+	r := new(Routes)
+	r.Set("*.internal", "direct")
+	r.Set("10.0.0.0/8", "direct")
+	r.Set("ads.example.com", "block")
+	r.Set("*", "socks5://127.0.0.1:9050")
+
+	def, _ := url.Parse("http://127.0.0.1:3128")
+
+	tests := []struct {
+		addr string
+		want string
+		err  error
+	}{
+		{"db.internal:443", "", nil},
+		{"10.1.2.3:80", "", nil},
+		{"ads.example.com:443", "", ErrBlocked},
+		{"www.example.com:443", "socks5://127.0.0.1:9050", nil},
+	}
+
+	for _, tt := range tests {
+		got, err := r.Proxy(context.Background(), tt.addr, def)
+		s := ""
+		if got != nil {
+			s = got.String()
+		}
+		if s != tt.want || err != tt.err {
+			t.Errorf("Proxy(%s) got %v %v want %v %v", tt.addr, s, err, tt.want, tt.err)
+		}
+	}
+
+	r.Remove("*")
+	if got, _ := r.Proxy(context.Background(), "www.example.com:443", def); got != def {
+		t.Errorf("Proxy without a match got %v want %v", got, def)
+	}
+
+	if err := r.Set("*.example.com", "ftp://127.0.0.1:21"); err == nil {
+		t.Errorf("Set with a bad action got nil want error")
+	}
+
+	// CIDR routes use cached DNS records while they're fresh
+	lookups.Lock()
+	lookups.hosts["cached.test"] = lookup{ips: []net.IP{net.ParseIP("10.9.9.9")}, expires: time.Now().Add(time.Minute)}
+	lookups.Unlock()
+	if got, err := r.Proxy(context.Background(), "cached.test:80", def); got != nil || err != nil {
+		t.Errorf("Proxy(cached.test:80) got %v %v want direct", got, err)
+	}
+}
+
+func TestVerifierCheck(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	conn, err := tls.Dial("tcp", srv.Listener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := conn.ConnectionState()
+	conn.Close()
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0600)
+
+	v, err := NewVerifier(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v.Check(cs, "example.com"); err != nil {
+		t.Errorf("Check(example.com) got %v want nil", err)
+	}
+	if err := v.Check(cs, "other.example.org"); err == nil {
+		t.Errorf("Check(other.example.org) got nil want error")
+	}
+
+	// an expired result is checked again
+	for k := range v.results {
+		if r := v.results[k]; r.expires.After(time.Now().Add(verifyTTL)) {
+			t.Errorf("Check cached a result until %s want no later than %s", r.expires, verifyTTL)
+		}
+		v.results[k] = verifyResult{err: errors.New("stale"), expires: time.Now().Add(-time.Second)}
+	}
+	if err := v.Check(cs, "example.com"); err != nil {
+		t.Errorf("Check(example.com) after expiry got %v want nil", err)
+	}
+
+	if v, _ = NewVerifier(""); v.Check(cs, "example.com") == nil {
+		t.Errorf("Check against the system roots got nil want error")
+	}
+}
@@ -0,0 +1,362 @@
+package dialer
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	netproxy "golang.org/x/net/proxy"
+)
+
+// Route actions other than an upstream proxy URI
+const (
+	RouteDirect = "direct"
+	RouteBlock  = "block"
+)
+
+// ErrBlocked - returned for destinations a block route matches
+var ErrBlocked = errors.New("blocked by routing rule")
+
+// Route - send connections for destinations matching Pattern the way Action says. Patterns
+// are hostnames, optionally with shell style wildcards, or CIDR ranges. Action is direct,
+// block or the URI of an HTTP or SOCKS5 upstream proxy
+type Route struct {
+	Pattern string
+	Action  string
+}
+
+type route struct {
+	Route
+	cidr  *net.IPNet
+	proxy *url.URL
+}
+
+// Routes - an ordered table of routing rules, the first match wins. Safe to edit while
+// connections are dialled
+type Routes struct {
+	mu     sync.RWMutex
+	routes []route
+}
+
+// Routing - the routes used by the proxy and the replayer
+var Routing = new(Routes)
+
+func parseRoute(pattern, action string) (route, error) {
+	r := route{Route: Route{
+		Pattern: strings.ToLower(strings.TrimSpace(pattern)),
+		Action:  strings.TrimSpace(action),
+	}}
+
+	if r.Pattern == "" {
+		return r, errors.New("empty route pattern")
+	}
+
+	if strings.Contains(r.Pattern, "/") {
+		_, n, err := net.ParseCIDR(r.Pattern)
+		if err != nil {
+			return r, errors.New("bad route CIDR " + r.Pattern)
+		}
+		r.cidr = n
+	} else if _, err := path.Match(r.Pattern, ""); err != nil {
+		return r, errors.New("bad route pattern " + r.Pattern)
+	}
+
+	switch strings.ToLower(r.Action) {
+	case RouteDirect, RouteBlock:
+		r.Action = strings.ToLower(r.Action)
+	default:
+		u, err := url.Parse(r.Action)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") || u.Port() == "" {
+			return r, errors.New("bad route action " + r.Action + ", expected direct, block or a proxy URI such as socks5://127.0.0.1:9050")
+		}
+		r.proxy = u
+	}
+
+	return r, nil
+}
+
+// Set - add a route to the end of the table, or change the action of an existing one
+func (r *Routes) Set(pattern, action string) error {
+	rt, err := parseRoute(pattern, action)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.routes {
+		if r.routes[i].Pattern == rt.Pattern {
+			r.routes[i] = rt
+			return nil
+		}
+	}
+	r.routes = append(r.routes, rt)
+	return nil
+}
+
+// Remove - remove the route for pattern
+func (r *Routes) Remove(pattern string) {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.routes {
+		if r.routes[i].Pattern == pattern {
+			r.routes = append(r.routes[:i], r.routes[i+1:]...)
+			return
+		}
+	}
+}
+
+// Move - move the route for pattern up (negative) or down (positive) the table
+func (r *Routes) Move(pattern string, by int) {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.routes {
+		if r.routes[i].Pattern == pattern {
+			j := min(max(i+by, 0), len(r.routes)-1)
+			rt := r.routes[i]
+			r.routes = append(r.routes[:i], r.routes[i+1:]...)
+			r.routes = append(r.routes[:j], append([]route{rt}, r.routes[j:]...)...)
+			return
+		}
+	}
+}
+
+// List - the current routes, in match order
+func (r *Routes) List() []Route {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	routes := make([]Route, len(r.routes))
+	for i, rt := range r.routes {
+		routes[i] = rt.Route
+	}
+	return routes
+}
+
+// match - the first route matching host. CIDR routes match IP addresses, and hostnames
+// by their override or, failing that, their DNS records
+func (r *Routes) match(ctx context.Context, host string) (route, bool) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	r.mu.RLock()
+	routes := r.routes
+	r.mu.RUnlock()
+
+	var ips []net.IP
+	resolved := false
+
+	for _, rt := range routes {
+		if rt.cidr == nil {
+			if ok, _ := path.Match(rt.Pattern, host); ok {
+				return rt, true
+			}
+			continue
+		}
+
+		if !resolved {
+			resolved = true
+			ips = lookupIP(ctx, host)
+		}
+		for _, ip := range ips {
+			if rt.cidr.Contains(ip) {
+				return rt, true
+			}
+		}
+	}
+
+	return route{}, false
+}
+
+// lookupTTL - how long a hostname's DNS records are used for matching CIDR routes, the
+// resolver doesn't report record TTLs. Failed lookups are retried sooner
+const (
+	lookupTTL       = time.Minute
+	lookupFailedTTL = 10 * time.Second
+)
+
+type lookup struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+// lookups - cached DNS records for matching CIDR routes, so requests don't each pay for
+// a lookup ahead of their dial
+var lookups = struct {
+	sync.Mutex
+	hosts map[string]lookup
+}{hosts: make(map[string]lookup)}
+
+func lookupIP(ctx context.Context, host string) []net.IP {
+	if ip, ok := Hosts.Lookup(host); ok {
+		host = ip
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}
+	}
+
+	lookups.Lock()
+	l, ok := lookups.hosts[host]
+	lookups.Unlock()
+	if ok && time.Now().Before(l.expires) {
+		return l.ips
+	}
+
+	l = lookup{expires: time.Now().Add(lookupTTL)}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		// a cancelled request says nothing about the host
+		if ctx.Err() != nil {
+			return nil
+		}
+		log.Printf("[!] Routes - %s doesn't resolve, CIDR routes don't apply to it: %s\n", host, err)
+		l.expires = time.Now().Add(lookupFailedTTL)
+	}
+	for _, a := range addrs {
+		l.ips = append(l.ips, a.IP)
+	}
+
+	lookups.Lock()
+	if len(lookups.hosts) > 4096 {
+		for h, old := range lookups.hosts {
+			if time.Now().After(old.expires) {
+				delete(lookups.hosts, h)
+			}
+		}
+	}
+	lookups.hosts[host] = l
+	lookups.Unlock()
+	return l.ips
+}
+
+// Proxy - the upstream proxy for a connection to addr, nil to connect directly. def is
+// used when no route matches. Destinations a block route matches return ErrBlocked
+func (r *Routes) Proxy(ctx context.Context, addr string, def *url.URL) (*url.URL, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+
+	rt, ok := r.match(ctx, host)
+	if !ok {
+		return def, nil
+	}
+
+	switch rt.Action {
+	case RouteDirect:
+		return nil, nil
+	case RouteBlock:
+		return nil, ErrBlocked
+	}
+	return rt.proxy, nil
+}
+
+// DialRoute - connect to addr the way the routing rules say, def is the upstream proxy
+// to use when no route matches and may be nil
+func DialRoute(ctx context.Context, network, addr string, def *url.URL) (net.Conn, error) {
+	proxyURL, err := Routing.Proxy(ctx, addr, def)
+	if err != nil {
+		return nil, err
+	}
+	return DialThrough(ctx, network, addr, proxyURL)
+}
+
+// DialThrough - connect to addr through an HTTP or SOCKS5 upstream proxy, or directly
+// when proxyURL is nil. Hostname overrides apply to the proxy, the proxy resolves addr
+func DialThrough(ctx context.Context, network, addr string, proxyURL *url.URL) (net.Conn, error) {
+	if proxyURL == nil {
+		return DialContext(ctx, network, addr)
+	}
+
+	if proxyURL.Scheme == "socks5" {
+		d, err := netproxy.FromURL(proxyURL, Direct)
+		if err != nil {
+			return nil, err
+		}
+		if cd, ok := d.(netproxy.ContextDialer); ok {
+			return cd.DialContext(ctx, network, addr)
+		}
+		return d.Dial(network, addr)
+	}
+
+	conn, err := DialContext(ctx, "tcp", proxyURL.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	if proxyURL.Scheme == "https" {
+		conn = tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname(), InsecureSkipVerify: true})
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(netDialer.Timeout)
+	}
+	conn.SetDeadline(deadline)
+
+	connect := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if u := proxyURL.User; u != nil {
+		pass, _ := u.Password()
+		connect.SetBasicAuth(u.Username(), pass)
+		connect.Header.Set("Proxy-Authorization", connect.Header.Get("Authorization"))
+		connect.Header.Del("Authorization")
+	}
+
+	if err := connect.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, connect)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, errors.New("upstream proxy CONNECT: " + res.Status)
+	}
+	conn.SetDeadline(time.Time{})
+
+	return &bufferedConn{conn, br}, nil
+}
+
+// bufferedConn - a net.Conn that reads through a bufio.Reader, so bytes buffered while
+// reading the upstream proxy's CONNECT response aren't lost
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// CloseWrite - half-close the connection when the underlying one supports it
+func (c *bufferedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return c.Conn.Close()
+}
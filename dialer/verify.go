@@ -0,0 +1,114 @@
+package dialer
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// verifyTTL - how long a chain's result is trusted before it's checked again
+const verifyTTL = 10 * time.Minute
+
+type verifyResult struct {
+	err     error
+	expires time.Time
+}
+
+// Verifier - checks upstream certificate chains against a set of roots. Connections are
+// never refused over a bad certificate, the result is returned so it can be recorded
+type Verifier struct {
+	roots *x509.CertPool // nil for the system roots
+
+	mu      sync.Mutex
+	results map[[sha256.Size]byte]verifyResult // by host and chain, so a chain isn't checked on every connection
+}
+
+// Verify - the verifier used by the proxy and the replayer, nil when verification is off
+var Verify *Verifier
+
+// NewVerifier - a verifier using the PEM certificates in bundle as roots, or the system
+// roots when bundle is empty
+func NewVerifier(bundle string) (*Verifier, error) {
+	v := &Verifier{results: make(map[[sha256.Size]byte]verifyResult)}
+	if bundle == "" {
+		return v, nil
+	}
+
+	pem, err := os.ReadFile(bundle)
+	if err != nil {
+		return nil, err
+	}
+
+	v.roots = x509.NewCertPool()
+	if !v.roots.AppendCertsFromPEM(pem) {
+		return nil, errors.New("no certificates found in " + bundle)
+	}
+
+	return v, nil
+}
+
+// Check - verify the chain a server presented for host. Results are cached for
+// verifyTTL, and good ones no later than the first certificate in the chain expires.
+// Failures are logged when the chain is checked, not when a cached result is used
+func (v *Verifier) Check(cs tls.ConnectionState, host string) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("no server certificate")
+	}
+
+	host = strings.Trim(host, "[]")
+
+	h := sha256.New()
+	h.Write([]byte(host))
+	for _, cert := range cs.PeerCertificates {
+		h.Write(cert.Raw)
+	}
+	var key [sha256.Size]byte
+	h.Sum(key[:0])
+
+	v.mu.Lock()
+	r, ok := v.results[key]
+	v.mu.Unlock()
+	if ok && time.Now().Before(r.expires) {
+		return r.err
+	}
+
+	// verifying can fetch intermediates over the network, so it's done without the lock
+	opts := x509.VerifyOptions{
+		DNSName:       host,
+		Roots:         v.roots,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+
+	r = verifyResult{expires: time.Now().Add(verifyTTL)}
+	if _, r.err = cs.PeerCertificates[0].Verify(opts); r.err != nil {
+		log.Printf("[!] Upstream certificate for %s failed verification: %s\n", host, r.err)
+	} else {
+		for _, cert := range cs.PeerCertificates {
+			if cert.NotAfter.Before(r.expires) {
+				r.expires = cert.NotAfter
+			}
+		}
+	}
+
+	v.mu.Lock()
+	if len(v.results) > 4096 {
+		for k, old := range v.results {
+			if time.Now().After(old.expires) {
+				delete(v.results, k)
+			}
+		}
+	}
+	v.results[key] = r
+	v.mu.Unlock()
+
+	return r.err
+}
@@ -3,6 +3,7 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -12,8 +13,10 @@ import (
 	"strings"
 
 	"github.com/denandz/glorp/browser"
+	"github.com/denandz/glorp/dialer"
 	"github.com/denandz/glorp/modifier"
 	"github.com/denandz/glorp/proxy"
+	"github.com/denandz/glorp/scanner"
 	"github.com/denandz/glorp/views"
 
 	"github.com/gdamore/tcell/v2"
@@ -24,6 +27,11 @@ import (
 type Window func() (title string, content tview.Primitive)
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "ca" {
+		caCommand(os.Args[2:])
+		return
+	}
+
 	// process command line flags
 	addr := flag.String("addr", "", "The bind address, default 0.0.0.0")
 	downstreamProxy := flag.String("proxy", "", "downstream proxy to use in URI format. example: socks5://127.0.0.1:9050. empty means no downstream proxy")
@@ -31,6 +39,74 @@ func main() {
 	key := flag.String("key", "", "Path to the CA cert's private key")
 	port := flag.Uint("port", 0, "Listen port for the proxy, default 8080")
 	cdpURL := flag.String("cdp", "", "Connect to a Chrome DevTools Protocol WebSocket URL (e.g., ws://127.0.0.1:9222/devtools/browser/...)")
+	clipboard := flag.String("clipboard", "osc52", "How copy actions reach the clipboard: osc52, or file to write a temp file instead")
+	passthrough := flag.String("passthrough", "", "Comma separated host patterns to tunnel without interception. example: *.apple.com,pinned.example.com")
+	autoPassthrough := flag.Int("auto-passthrough", 0, "Tunnel hosts without interception after this many failed client TLS handshakes, 0 disables")
+	transparent := flag.Bool("transparent", false, "Also accept clients that aren't proxy aware, taking the destination from the Host header or TLS SNI")
+	var listeners, reverse []proxy.ListenerConfig
+	flag.Func("listen", "Proxy listener as [addr:]port[,mode=explicit|transparent|reverse|socks5][,auth=user:pass][,allow=cidr][,tag=name][,proxy=uri|direct][,upstream=uri][,name=certname][,cert=file,key=file], repeatable. Replaces -port and -transparent", func(s string) error {
+		lc, err := proxy.ParseListener(s)
+		if err == nil {
+			listeners = append(listeners, lc)
+		}
+		return err
+	})
+	flag.Func("reverse", "Reverse proxy listener as port=upstream[=certname], repeatable. example: 8443=https://api.internal:8443", func(s string) error {
+		lc, err := proxy.ParseReverse(s)
+		if err == nil {
+			reverse = append(reverse, lc)
+		}
+		return err
+	})
+	allow := flag.String("allow", "", "Comma separated IP addresses and CIDR ranges allowed to use the proxy, empty allows everyone. example: 127.0.0.1,10.0.0.0/8")
+	auth := flag.String("auth", "", "Require user:password proxy credentials from clients of explicit and SOCKS5 listeners")
+	hostsFile := flag.String("hosts", "", "Hosts file of hostname overrides, in the /etc/hosts format")
+	flag.Func("resolve", "Hostname override as pattern=ip, repeatable. example: *.staging.example.com=10.0.0.5", func(s string) error {
+		pattern, ip, ok := strings.Cut(s, "=")
+		if !ok {
+			return errors.New("expected pattern=ip")
+		}
+		return dialer.Hosts.Set(pattern, ip)
+	})
+	flag.Func("route", "Routing rule as pattern=direct|block|proxy-uri, repeatable, the first matching rule wins. Patterns are host patterns or CIDR ranges. example: 10.0.0.0/8=direct", func(s string) error {
+		pattern, action, ok := strings.Cut(s, "=")
+		if !ok {
+			return errors.New("expected pattern=action")
+		}
+		return dialer.Routing.Set(pattern, action)
+	})
+	flag.Func("block", "Block rule as pattern=action, repeatable. Requests matching the URL pattern never reach the server, the action is drop, a status code and optional body, or @file with a raw HTTP response. example: telemetry.example.com=204", func(s string) error {
+		pattern, action, ok := strings.Cut(s, "=")
+		if !ok {
+			return errors.New("expected pattern=action")
+		}
+		return modifier.Blocks.Set(pattern, action)
+	})
+	flag.Func("map-local", "Map Local rule as pattern=path, repeatable. Requests matching the URL pattern are answered from the file, or from the directory below the pattern's path. example: example.com/static=./build", func(s string) error {
+		pattern, file, ok := strings.Cut(s, "=")
+		if !ok {
+			return errors.New("expected pattern=path")
+		}
+		return modifier.MapLocal.Set(pattern, file)
+	})
+	flag.Func("map-remote", "Map Remote rule as pattern=url, repeatable. Requests matching the URL pattern are sent to the URL's scheme and host, and its path replaces the pattern's path. example: api.example.com/v1=http://localhost:3000/v1", func(s string) error {
+		pattern, to, ok := strings.Cut(s, "=")
+		if !ok {
+			return errors.New("expected pattern=url")
+		}
+		return modifier.MapRemote.Set(pattern, to)
+	})
+	flag.Func("network", "Network condition rule as pattern=conditions, repeatable. Conditions are a comma separated list of latency=duration, bandwidth=bytes per second, and reset, truncate and error probabilities, with status=5xx for injected errors. example: api.example.com=latency=300ms,bandwidth=64k,error=0.1", func(s string) error {
+		pattern, conditions, ok := strings.Cut(s, "=")
+		if !ok {
+			return errors.New("expected pattern=conditions")
+		}
+		return modifier.Network.Set(pattern, conditions)
+	})
+	verify := flag.Bool("verify", false, "Verify upstream certificates against the system roots, recording failures as findings rather than refusing the connection")
+	verifyCA := flag.String("verify-ca", "", "Verify upstream certificates against the PEM bundle in this file instead of the system roots, implies -verify")
+	flag.Int64Var(&modifier.SpillSize, "spill-size", modifier.SpillSize, "Body bytes kept in memory per request or response, larger bodies are captured to a temp file")
+	flag.Int64Var(&modifier.MaxCapture, "max-capture", modifier.MaxCapture, "Body bytes captured per request or response, the rest is passed on but not recorded. 0 for no limit")
 	help := flag.Bool("help", false, "Show help")
 	flag.Parse()
 
@@ -45,13 +121,36 @@ func main() {
 		}
 	}
 
+	if *allow != "" {
+		if _, err := proxy.ParseAllow(strings.Split(*allow, ",")); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *hostsFile != "" {
+		if err := dialer.Hosts.LoadHostsFile(*hostsFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *verify || *verifyCA != "" {
+		v, err := dialer.NewVerifier(*verifyCA)
+		if err != nil {
+			log.Fatal(err)
+		}
+		dialer.Verify = v
+	}
+
 	if *help ||
+		(*clipboard != "osc52" && *clipboard != "file") ||
+		(*auth != "" && !strings.Contains(*auth, ":")) ||
 		(*cert == "" && *key != "") ||
 		(*key == "" && *cert != "") {
 		flag.Usage()
 		os.Exit(1)
 	}
 
+	views.Clipboard = *clipboard
 	app := tview.NewApplication()
 
 	// create the replayview stuff
@@ -65,12 +164,40 @@ func main() {
 		Proxy: *downstreamProxy,
 		Key:   *key,
 		Port:  *port,
+
+		Transparent:     *transparent,
+		AutoPassthrough: *autoPassthrough,
+		Auth:            *auth,
+	}
+	if *allow != "" {
+		config.Allow = strings.Split(*allow, ",")
+	}
+
+	// reverse listeners run alongside the default listener, unless -listen replaced it
+	if len(listeners) == 0 && len(reverse) > 0 {
+		lc := proxy.ListenerConfig{Port: *port, Mode: proxy.ModeExplicit}
+		if lc.Port == 0 {
+			lc.Port = 8080
+		}
+		if *transparent {
+			lc.Mode = proxy.ModeTransparent
+		}
+		listeners = append(listeners, lc)
+	}
+	config.Listeners = append(listeners, reverse...)
+
+	if *passthrough != "" {
+		config.Passthrough = strings.Split(*passthrough, ",")
 	}
 
 	proxychan := make(chan modifier.Notification, 1024)
 	sitemapchan := make(chan modifier.Notification, 1024)
 	wschan := make(chan modifier.Notification, 1024)
+	issuechan := make(chan string, 1024)
 	logger := modifier.NewLogger(app, proxychan, sitemapchan, wschan)
+	issueScanner := scanner.New(issuechan)
+	logger.SetResponseHook(issueScanner.Submit)
+	logger.SetResetHook(issueScanner.Reset)
 	proxy.StartProxy(logger, config)
 
 	// start the browser CDP capture if requested
@@ -113,15 +240,25 @@ func main() {
 	sitemapview := new(views.SiteMapView)
 	sitemapview.Init(app, proxyview.Logger, sitemapchan)
 
+	// rules view
+	rulesview := new(views.RulesView)
+	rulesview.Init(app)
+
+	// issues view
+	issuesview := new(views.IssuesView)
+	issuesview.Init(app, issueScanner, logger, issuechan)
+
 	// Save/load view
 	saveview := new(views.SaveRestoreView)
-	saveview.Init(app, replayview, proxyview, sitemapview, websocketview)
+	saveview.Init(app, replayview, proxyview, sitemapview, websocketview, issuesview)
 
 	// Pages
 	pages := []Window{
 		proxyview.GetView,
 		sitemapview.GetView,
 		replayview.GetView,
+		rulesview.GetView,
+		issuesview.GetView,
 		Log,
 		saveview.GetView,
 	}
@@ -197,8 +334,11 @@ func main() {
 		return event
 	})
 
+	// bodies spilled to disk don't outlive the session, saves hold their own copy
+	defer modifier.RemoveSpillFiles()
+
 	// Start the application.
-	if err := app.SetRoot(layout, true).EnableMouse(true).SetFocus(proxyview.Table).Run(); err != nil {
+	if err := app.SetRoot(layout, true).EnableMouse(true).EnablePaste(true).SetFocus(proxyview.Table).Run(); err != nil {
 		panic(err)
 	}
 }
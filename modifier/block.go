@@ -0,0 +1,105 @@
+package modifier
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Blocks - rules for requests that never reach the server. They're dropped, or answered
+// with a synthetic response, and recorded in the history flagged as blocked
+var Blocks = NewRules(parseBlock)
+
+// BlockDrop - the block rule value that closes the client connection without a response
+const BlockDrop = "drop"
+
+// blockAction - what a block rule does with a request: drop it, answer it with status
+// and body, or answer it with the raw HTTP response in file
+type blockAction struct {
+	drop   bool
+	status int
+	body   string
+	file   string
+}
+
+// parseBlock - a block value is drop, a status code optionally followed by a body, or
+// @file for a file holding a raw HTTP response with headers of its own
+func parseBlock(value string) (any, error) {
+	if strings.EqualFold(value, BlockDrop) {
+		return &blockAction{drop: true}, nil
+	}
+
+	if file, ok := strings.CutPrefix(value, "@"); ok {
+		if _, err := os.Stat(file); err != nil {
+			return nil, err
+		}
+		return &blockAction{file: file}, nil
+	}
+
+	code, body, _ := strings.Cut(value, " ")
+	status, err := strconv.Atoi(code)
+	if err != nil || status < 100 || status > 599 {
+		return nil, errors.New("bad block action " + value + ", expected drop, a status code and optional body such as 204 or 403 blocked, or @file with a raw response")
+	}
+	return &blockAction{status: status, body: body}, nil
+}
+
+// respond - replace a response with the block's synthetic one
+func (b *blockAction) respond(res *http.Response) {
+	status, header, body := b.status, make(http.Header), []byte(b.body)
+	if b.body != "" {
+		header.Set("Content-Type", "text/plain; charset=utf-8")
+	}
+
+	if b.file != "" {
+		var err error
+		if status, header, body, err = readRawResponse(b.file); err != nil {
+			log.Printf("[!] Block - %s: %s\n", b.file, err)
+			status, header, body = http.StatusBadGateway, make(http.Header), nil
+		}
+	}
+
+	res.StatusCode = status
+	res.Status = strconv.Itoa(status) + " " + http.StatusText(status)
+	res.Header = header
+	res.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	res.Header.Del("Transfer-Encoding")
+	res.TransferEncoding = nil
+	res.ContentLength = int64(len(body))
+	res.Body = io.NopCloser(bytes.NewReader(body))
+}
+
+// readRawResponse - the status, headers and body of the raw HTTP response in file. Bare
+// newlines are fine, so the file can be written in any editor
+func readRawResponse(file string) (int, http.Header, []byte, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(raw)), nil)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer res.Body.Close()
+
+	// the body runs to the end of the file whatever the headers say
+	res.Header.Del("Content-Length")
+	i := bytes.Index(raw, []byte("\r\n\r\n"))
+	j := bytes.Index(raw, []byte("\n\n"))
+	var body []byte
+	switch {
+	case i != -1 && (j == -1 || i < j):
+		body = raw[i+4:]
+	case j != -1:
+		body = raw[j+2:]
+	}
+
+	return res.StatusCode, res.Header, body, nil
+}
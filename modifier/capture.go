@@ -0,0 +1,223 @@
+package modifier
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+// Body capture limits. Bodies always stream through the proxy untouched, these only
+// decide how much of them is recorded.
+var (
+	// SpillSize is how many body bytes are kept in memory per message. Bigger bodies
+	// are written to a temp file, and Raw only holds the start of them.
+	SpillSize int64 = 4 << 20
+	// MaxCapture is how many body bytes are recorded per message, 0 for no limit.
+	// Anything past it is passed on but not recorded, and the message is marked truncated.
+	MaxCapture int64 = 256 << 20
+)
+
+// capture records a body as it streams past. The first SpillSize bytes are kept in
+// memory, once there are more everything captured goes to a temp file.
+type capture struct {
+	mem       bytes.Buffer
+	file      *os.File
+	noSpill   bool  // the temp file couldn't be created, the body is kept in memory
+	size      int64 // bytes seen, including any past MaxCapture
+	truncated bool
+}
+
+// spills are the temp files bodies have been spilled to, so they can be removed
+var spills = struct {
+	sync.Mutex
+	files map[string]bool
+}{files: make(map[string]bool)}
+
+// removeSpill deletes a spill file, leaving files this process didn't create alone.
+func removeSpill(name string) {
+	spills.Lock()
+	defer spills.Unlock()
+
+	if spills.files[name] {
+		os.Remove(name)
+		delete(spills.files, name)
+	}
+}
+
+// RemoveSpillFiles deletes every temp file bodies have been spilled to. Called on exit.
+func RemoveSpillFiles() {
+	spills.Lock()
+	defer spills.Unlock()
+
+	for name := range spills.files {
+		os.Remove(name)
+	}
+	spills.files = make(map[string]bool)
+}
+
+func (c *capture) Write(p []byte) {
+	c.size += int64(len(p))
+
+	if MaxCapture > 0 {
+		captured := c.size - int64(len(p))
+		if captured >= MaxCapture {
+			c.truncated = true
+			return
+		}
+		if captured+int64(len(p)) > MaxCapture {
+			c.truncated = true
+			p = p[:MaxCapture-captured]
+		}
+	}
+
+	if c.file == nil && !c.noSpill && int64(c.mem.Len()+len(p)) > SpillSize {
+		f, err := os.CreateTemp("", "glorp-body-")
+		if err != nil {
+			log.Printf("[!] Capture - can't spill body to disk, keeping it in memory: %s\n", err)
+			c.noSpill = true
+		} else {
+			spills.Lock()
+			spills.files[f.Name()] = true
+			spills.Unlock()
+
+			f.Write(c.mem.Bytes())
+			c.file = f
+		}
+	}
+
+	if c.file != nil {
+		c.file.Write(p)
+		if n := SpillSize - int64(c.mem.Len()); n > 0 {
+			c.mem.Write(p[:min(n, int64(len(p)))])
+		}
+		return
+	}
+	c.mem.Write(p)
+}
+
+// teeBody passes a body through, capturing it on the way. done is called once, when
+// the body has been read to the end or closed.
+type teeBody struct {
+	io.ReadCloser
+	c    capture
+	once sync.Once
+	done func(c *capture)
+}
+
+func newTeeBody(body io.ReadCloser, done func(c *capture)) *teeBody {
+	return &teeBody{ReadCloser: body, done: done}
+}
+
+func (t *teeBody) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	t.c.Write(p[:n])
+	if err != nil {
+		t.finish()
+	}
+	return n, err
+}
+
+func (t *teeBody) Close() error {
+	err := t.ReadCloser.Close()
+	t.finish()
+	return err
+}
+
+func (t *teeBody) finish() {
+	t.once.Do(func() {
+		if t.c.file != nil {
+			t.c.file.Close()
+		}
+		t.done(&t.c)
+	})
+}
+
+// spillFile is the name of the temp file holding the captured body, empty when it fit in memory.
+func (c *capture) spillFile() string {
+	if c.file == nil {
+		return ""
+	}
+	return c.file.Name()
+}
+
+// frameBody appends body to a message head, chunk encoding it when the head says the
+// message is chunked so the result still parses.
+func frameBody(head, body []byte) []byte {
+	raw := append([]byte(nil), head...)
+	if len(body) == 0 {
+		return raw
+	}
+
+	if !isChunked(head) {
+		return append(raw, body...)
+	}
+	raw = fmt.Appendf(raw, "%x\r\n", len(body))
+	raw = append(raw, body...)
+	return append(raw, "\r\n0\r\n\r\n"...)
+}
+
+func isChunked(head []byte) bool {
+	return bytes.Contains(bytes.ToLower(head), []byte("\r\ntransfer-encoding: chunked\r\n"))
+}
+
+// messageHead is the start line and headers of a raw message, up to and including the blank line.
+func messageHead(raw []byte) []byte {
+	if i := bytes.Index(raw, []byte("\r\n\r\n")); i != -1 {
+		return raw[:i+4]
+	}
+	return raw
+}
+
+// fullRaw is a raw message with the whole captured body, reading it back from the spill
+// file when there is one. Raw is returned as it is when the file can't be read.
+func fullRaw(raw []byte, file string) []byte {
+	if file == "" {
+		return raw
+	}
+
+	body, err := os.ReadFile(file)
+	if err != nil {
+		log.Printf("[!] Capture - reading spilled body: %s\n", err)
+		return raw
+	}
+
+	return frameBody(messageHead(raw), body)
+}
+
+// Full returns the raw request with its whole captured body.
+func (r *Request) Full() []byte {
+	return fullRaw(r.Raw, r.BodyFile)
+}
+
+// Full returns the raw response with its whole captured body.
+func (r *Response) Full() []byte {
+	return fullRaw(r.Raw, r.BodyFile)
+}
+
+// Inlined returns a copy of the entry with any spilled bodies read back into Raw, so it
+// doesn't depend on temp files, such as when it's saved.
+func (e Entry) Inlined() Entry {
+	if e.Request != nil && e.Request.BodyFile != "" {
+		r := *e.Request
+		r.Raw, r.BodyFile = r.Full(), ""
+		e.Request = &r
+	}
+	if e.Response != nil && e.Response.BodyFile != "" {
+		r := *e.Response
+		r.Raw, r.BodyFile = r.Full(), ""
+		e.Response = &r
+	}
+	return e
+}
+
+// Size is the length of the raw response with its whole body, which is more than
+// len(Raw) when the body was spilled to disk or truncated.
+func (r *Response) Size() int64 {
+	if r.BodyFile == "" && !r.Truncated {
+		return int64(len(r.Raw))
+	}
+	return int64(len(messageHead(r.Raw))) + r.BodySize
+}
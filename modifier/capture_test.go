@@ -0,0 +1,73 @@
+package modifier
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestTeeBody(t *testing.T) {
+	spill, max := SpillSize, MaxCapture
+	defer func() { SpillSize, MaxCapture = spill, max }()
+	SpillSize, MaxCapture = 10, 25
+
+	body := bytes.Repeat([]byte("0123456789"), 4)
+
+	var got *capture
+	tee := newTeeBody(io.NopCloser(bytes.NewReader(body)), func(c *capture) { got = c })
+
+	passed, err := io.ReadAll(tee)
+	if err != nil || !bytes.Equal(passed, body) {
+		t.Fatalf("TestTeeBody passed through got %q %v want %q", passed, err, body)
+	}
+
+	if got == nil {
+		t.Fatalf("TestTeeBody done wasn't called")
+	}
+	defer os.Remove(got.spillFile())
+
+	if got.size != 40 || !got.truncated {
+		t.Errorf("TestTeeBody got size %d truncated %v want 40 true", got.size, got.truncated)
+	}
+	if got.mem.String() != "0123456789" {
+		t.Errorf("TestTeeBody in memory got %q want %q", got.mem.String(), "0123456789")
+	}
+
+	spilled, _ := os.ReadFile(got.spillFile())
+	if !bytes.Equal(spilled, body[:25]) {
+		t.Errorf("TestTeeBody spilled got %q want %q", spilled, body[:25])
+	}
+}
+
+func TestFrameBody(t *testing.T) {
+	head := []byte("HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n")
+
+	got := string(frameBody(head, []byte("hello")))
+	want := string(head) + "5\r\nhello\r\n0\r\n\r\n"
+	if got != want {
+		t.Errorf("TestFrameBody got %q want %q", got, want)
+	}
+}
+
+func TestInlined(t *testing.T) {
+	f, err := os.CreateTemp("", "glorp-body-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("hello world")
+	f.Close()
+
+	head := "HTTP/1.1 200 OK\r\nContent-Length: 11\r\n\r\n"
+	res := &Response{Raw: []byte(head + "hello"), BodyFile: f.Name()}
+	e := Entry{Response: res}
+
+	got := e.Inlined()
+	if string(got.Response.Raw) != head+"hello world" || got.Response.BodyFile != "" {
+		t.Errorf("TestInlined got %q %q want %q", got.Response.Raw, got.Response.BodyFile, head+"hello world")
+	}
+	if res.BodyFile != f.Name() {
+		t.Errorf("TestInlined changed the original entry")
+	}
+}
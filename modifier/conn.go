@@ -0,0 +1,181 @@
+package modifier
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"slices"
+	"time"
+
+	"github.com/denandz/glorp/dialer"
+)
+
+// ConnInfo holds details of the connections an entry went over.
+type ConnInfo struct {
+	// ClientAddr is the address of the client that sent the request.
+	ClientAddr string `json:"clientAddr,omitempty"`
+	// RemoteAddr is the address that was actually dialled, after hostname overrides.
+	// It's the downstream proxy's address when one is in use.
+	RemoteAddr string `json:"remoteAddr,omitempty"`
+
+	// TLSVersion, CipherSuite, ALPN and SNI are what was negotiated with the server.
+	TLSVersion  string `json:"tlsVersion,omitempty"`
+	CipherSuite string `json:"cipherSuite,omitempty"`
+	ALPN        string `json:"alpn,omitempty"`
+	SNI         string `json:"sni,omitempty"`
+	// Certificates is the DER encoded chain the server presented, leaf first.
+	Certificates [][]byte `json:"certificates,omitempty"`
+
+	// Timings breaks down where the time went.
+	Timings *Timings `json:"timings,omitempty"`
+}
+
+// Timings is the time taken by each stage of a request. Stages that didn't happen,
+// such as DNS and connecting on a reused connection, are zero.
+type Timings struct {
+	// DNS is the time spent resolving the hostname.
+	DNS time.Duration `json:"dns"`
+	// Connect is the time spent establishing the TCP connection.
+	Connect time.Duration `json:"connect"`
+	// TLS is the time spent on the TLS handshake.
+	TLS time.Duration `json:"tls"`
+	// TTFB is the time from the request being sent to the first response byte.
+	TTFB time.Duration `json:"ttfb"`
+	// Transfer is the time from the first response byte to the end of the body.
+	Transfer time.Duration `json:"transfer"`
+	// Reused is set when the request went over an existing connection.
+	Reused bool `json:"reused,omitempty"`
+
+	firstByte time.Time
+}
+
+// conn returns the entry's ConnInfo, creating it if needed. Callers hold l.mu.
+func (l *Logger) conn(id string) *ConnInfo {
+	e, ok := l.entries[id]
+	if !ok {
+		return nil
+	}
+	if e.Conn == nil {
+		e.Conn = new(ConnInfo)
+	}
+	return e.Conn
+}
+
+// timings returns the entry's Timings, creating it if needed. Callers hold l.mu.
+func (l *Logger) timings(id string) *Timings {
+	c := l.conn(id)
+	if c == nil {
+		return nil
+	}
+	if c.Timings == nil {
+		c.Timings = new(Timings)
+	}
+	return c.Timings
+}
+
+// trace returns a ClientTrace that records the connection details and timings of the
+// entry's upstream request. host is the name the request is for.
+func (l *Logger) trace(id string, host string) *httptrace.ClientTrace {
+	var dnsStart, connectStart, tlsStart, wrote time.Time
+
+	// the hooks run on the transport's goroutines, so the start times are kept under l.mu
+	mark := func(start *time.Time) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		*start = time.Now()
+	}
+
+	// since records the time from start into the field set picks, if start happened
+	since := func(start *time.Time, set func(t *Timings, d time.Duration)) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if start.IsZero() {
+			return
+		}
+		if t := l.timings(id); t != nil {
+			set(t, time.Since(*start))
+		}
+	}
+
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { mark(&dnsStart) },
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			since(&dnsStart, func(t *Timings, d time.Duration) { t.DNS = d })
+		},
+		ConnectStart: func(string, string) { mark(&connectStart) },
+		ConnectDone: func(string, string, error) {
+			since(&connectStart, func(t *Timings, d time.Duration) { t.Connect = d })
+		},
+		TLSHandshakeStart: func() { mark(&tlsStart) },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			since(&tlsStart, func(t *Timings, d time.Duration) { t.TLS = d })
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			l.SetRemoteAddr(id, info.Conn.RemoteAddr().String())
+			if tc, ok := info.Conn.(*tls.Conn); ok {
+				l.RecordTLS(id, host, tc.ConnectionState())
+			}
+
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			if t := l.timings(id); t != nil {
+				t.Reused = info.Reused
+			}
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) { mark(&wrote) },
+		GotFirstResponseByte: func() {
+			since(&wrote, func(t *Timings, d time.Duration) {
+				t.TTFB = d
+				t.firstByte = time.Now()
+			})
+		},
+	}
+}
+
+// SetRemoteAddr records the address the entry's upstream connection was made to
+func (l *Logger) SetRemoteAddr(id string, addr string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if c := l.conn(id); c != nil {
+		c.RemoteAddr = addr
+	}
+}
+
+// RecordTLS stores the negotiated parameters and certificate chain of the entry's
+// upstream connection and, when verification is on, adds a finding if host's
+// certificate doesn't verify
+func (l *Logger) RecordTLS(id string, host string, cs tls.ConnectionState) {
+	var finding *Finding
+	if dialer.Verify != nil {
+		if err := dialer.Verify.Check(cs, host); err != nil {
+			finding = &Finding{
+				Name:     "Untrusted upstream certificate",
+				Severity: SeverityMedium,
+				Detail:   err.Error(),
+			}
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c := l.conn(id)
+	if c == nil {
+		return
+	}
+
+	c.TLSVersion = tls.VersionName(cs.Version)
+	c.CipherSuite = tls.CipherSuiteName(cs.CipherSuite)
+	c.ALPN = cs.NegotiatedProtocol
+	c.SNI = cs.ServerName
+
+	c.Certificates = nil
+	for _, cert := range cs.PeerCertificates {
+		c.Certificates = append(c.Certificates, cert.Raw)
+	}
+
+	if e := l.entries[id]; finding != nil && !slices.Contains(e.Findings, *finding) {
+		e.Findings = append(e.Findings, *finding)
+	}
+}
@@ -0,0 +1,139 @@
+package modifier
+
+import (
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Map rules used by the proxy. Map Local answers matching requests from a local file or
+// directory, Map Remote sends them to another server
+var (
+	MapLocal  = NewRules(parseMapLocal)
+	MapRemote = NewRules(parseMapRemote)
+)
+
+// parseMapLocal - a Map Local value is a file, or a directory that paths below the
+// pattern's path are looked up in
+func parseMapLocal(value string) (any, error) {
+	if value == "" {
+		return nil, errors.New("empty local path")
+	}
+
+	abs, err := filepath.Abs(value)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(abs); err != nil {
+		return nil, err
+	}
+	return abs, nil
+}
+
+// parseMapRemote - a Map Remote value is a URL, its scheme and host replace the
+// request's and a path replaces the pattern's path
+func parseMapRemote(value string) (any, error) {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("bad remote URL " + value + ", expected a URL such as http://localhost:3000/api")
+	}
+	return u, nil
+}
+
+// localFile - the file a Map Local rule answers a request for urlPath with
+func localFile(rl rule, urlPath string) string {
+	base := rl.value.(string)
+
+	fi, err := os.Stat(base)
+	if err != nil || !fi.IsDir() {
+		return base
+	}
+
+	// cleaning against / keeps the path inside the directory
+	rest := path.Clean("/" + rl.pattern.rest(urlPath))
+	return filepath.Join(base, filepath.FromSlash(rest))
+}
+
+// serveLocal - replace a response with the contents of file, or a 404 when it can't be read
+func serveLocal(res *http.Response, file string) {
+	res.Header = make(http.Header)
+
+	f, size, err := openLocal(file)
+	if err != nil {
+		log.Printf("[!] Map Local - %s\n", err)
+
+		body := "Not found: " + file + "\n"
+		res.StatusCode = http.StatusNotFound
+		res.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		res.Body = io.NopCloser(strings.NewReader(body))
+		res.ContentLength = int64(len(body))
+	} else {
+		res.StatusCode = http.StatusOK
+		res.Header.Set("Content-Type", contentType(f))
+		res.Body = f
+		res.ContentLength = size
+	}
+
+	res.Status = strconv.Itoa(res.StatusCode) + " " + http.StatusText(res.StatusCode)
+	res.Header.Set("Content-Length", strconv.FormatInt(res.ContentLength, 10))
+	res.TransferEncoding = nil
+
+	if res.Request.Method == http.MethodHead {
+		res.Body.Close()
+		res.Body = http.NoBody
+	}
+}
+
+// openLocal - open file, or the index.html in it when it's a directory
+func openLocal(file string) (*os.File, int64, error) {
+	fi, err := os.Stat(file)
+	if err == nil && fi.IsDir() {
+		file = filepath.Join(file, "index.html")
+		fi, err = os.Stat(file)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, 0, err
+	}
+	return f, fi.Size(), nil
+}
+
+// contentType - the Content-Type for a local file, by its extension or failing that its contents
+func contentType(f *os.File) string {
+	if ctype := mime.TypeByExtension(filepath.Ext(f.Name())); ctype != "" {
+		return ctype
+	}
+
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(f, buf)
+	f.Seek(0, io.SeekStart)
+	return http.DetectContentType(buf[:n])
+}
+
+// mapRemote - point req at to. The pattern's path is swapped for to's path when it has
+// one, the rest of the path and the query are kept
+func mapRemote(req *http.Request, p urlPattern, to *url.URL) {
+	if to.Path != "" {
+		req.URL.Path = strings.TrimSuffix(to.Path, "/") + p.rest(req.URL.Path)
+		if !strings.HasPrefix(req.URL.Path, "/") {
+			req.URL.Path = "/" + req.URL.Path
+		}
+		req.URL.RawPath = ""
+	}
+
+	req.URL.Scheme = to.Scheme
+	req.URL.Host = to.Host
+	req.Host = to.Host
+}
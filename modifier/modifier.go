@@ -2,8 +2,12 @@ package modifier
 
 import (
 	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptrace"
 	"net/http/httputil"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
@@ -21,6 +25,8 @@ type Logger struct {
 	sitemapnotificationchan chan Notification
 	wsnotificationchan      chan Notification
 	app                     *tview.Application
+	responseHook            func(e *Entry)
+	resetHook               func()
 }
 
 // Notification channel struct. Holds the element ID and an int for request or response
@@ -33,10 +39,13 @@ type Notification struct {
 type SourceType string
 
 const (
-	SourceProxy SourceType = "proxy"
+	SourceProxy   SourceType = "proxy"
 	SourceBrowser SourceType = "browser"
+	SourceTunnel  SourceType = "tunnel" // a CONNECT tunnel passed through without interception
 )
 
+// TagKey is the martian session key holding the tag of the listener a connection came in on
+const TagKey = "glorp.tag"
 
 // Entries stores all the Entry items
 type Entries map[string]*Entry
@@ -54,7 +63,37 @@ type Entry struct {
 	// Response contains the detailed information about the response.
 	Response *Response `json:"response,omitempty"`
 	// Source shows where the entry originated from. Proxy, browser, etc
-	Source	SourceType `json:"sourcetype,omitempty"`
+	Source SourceType `json:"sourcetype,omitempty"`
+	// Tag is the tag of the proxy listener the request came in on, if it has one
+	Tag string `json:"tag,omitempty"`
+	// Conn holds details of the upstream connection the request went over
+	Conn *ConnInfo `json:"conn,omitempty"`
+	// Findings are problems noticed with the entry, such as an untrusted upstream certificate
+	Findings []Finding `json:"findings,omitempty"`
+	// Blocked is set when a block rule stopped the request reaching the server. It's
+	// answered with a synthetic response, or has none when it was dropped.
+	Blocked bool `json:"blocked,omitempty"`
+	// Fault is the failure a network rule injected, such as a reset connection or a
+	// truncated response.
+	Fault string `json:"fault,omitempty"`
+}
+
+// Finding severities
+const (
+	SeverityHigh   = "High"
+	SeverityMedium = "Medium"
+	SeverityLow    = "Low"
+	SeverityInfo   = "Info"
+)
+
+// Finding is a problem noticed with an entry.
+type Finding struct {
+	// Name is a short description of the problem.
+	Name string `json:"name"`
+	// Severity is one of the Severity constants.
+	Severity string `json:"severity"`
+	// Detail explains what was found.
+	Detail string `json:"detail,omitempty"`
 }
 
 // Request holds data about an individual HTTP request.
@@ -72,6 +111,12 @@ type Request struct {
 	Raw  []byte // the raw body
 	Host string
 	TLS  bool
+
+	// BodyFile is the temp file holding the whole captured body, when it was too big to
+	// keep in memory. Raw only has the start of the body then.
+	BodyFile string `json:"bodyFile,omitempty"`
+	// Truncated is set when the body was bigger than the capture limit, BodySize is the full size.
+	Truncated bool `json:"truncated,omitempty"`
 }
 
 // Response holds data about an individual HTTP response.
@@ -91,6 +136,12 @@ type Response struct {
 	BodySize int64 `json:"bodySize"`
 
 	Raw []byte // the raw body
+
+	// BodyFile is the temp file holding the whole captured body, when it was too big to
+	// keep in memory. Raw only has the start of the body then.
+	BodyFile string `json:"bodyFile,omitempty"`
+	// Truncated is set when the body was bigger than the capture limit, BodySize is the full size.
+	Truncated bool `json:"truncated,omitempty"`
 }
 
 // NewLogger returns a HAR logger. The returned
@@ -121,21 +172,47 @@ func (l *Logger) ModifyRequest(req *http.Request) error {
 
 	id := ctx.ID()
 
-	e := l.RecordRequest(id, req, SourceProxy)
+	e := l.recordRequest(id, req, SourceProxy, true)
 
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	if entry, ok := l.entries[id]; ok {
+		entry.Tag = sessionTag(ctx)
+		_, entry.Blocked = ctx.Get(blockKey)
+		if ns := networkState(ctx); ns != nil {
+			entry.Fault = ns.fault
+		}
+	}
+
+	// record where the request actually goes, and how long it takes, once the transport has it
+	*req = *req.WithContext(httptrace.WithClientTrace(req.Context(), l.trace(id, req.URL.Hostname())))
+
 	l.proxynotificationchan <- Notification{id, 0}
 	l.sitemapnotificationchan <- Notification{id, 0}
 
 	return e
 }
 
+// sessionTag returns the listener tag stored in the connection's session
+func sessionTag(ctx *martian.Context) string {
+	if v, ok := ctx.Session().Get(TagKey); ok {
+		tag, _ := v.(string)
+		return tag
+	}
+	return ""
+}
+
 // RecordRequest logs the HTTP request with the given ID. The ID should be unique
 // per request/response pair.
 func (l *Logger) RecordRequest(id string, req *http.Request, source SourceType) error {
-	hreq, err := NewRequest(req)
+	return l.recordRequest(id, req, source, false)
+}
+
+// recordRequest logs a request. With stream set, the body is captured as it's sent
+// upstream instead of being read up front, and Raw only has the head until then.
+func (l *Logger) recordRequest(id string, req *http.Request, source SourceType, stream bool) error {
+	hreq, err := newRequest(req, !stream)
 	if err != nil {
 		return err
 	}
@@ -144,7 +221,10 @@ func (l *Logger) RecordRequest(id string, req *http.Request, source SourceType)
 		ID:              id,
 		StartedDateTime: time.Now().UTC(),
 		Request:         hreq,
-		Source:		 source,
+		Source:          source,
+	}
+	if req.RemoteAddr != "" {
+		entry.Conn = &ConnInfo{ClientAddr: req.RemoteAddr}
 	}
 
 	l.mu.Lock()
@@ -155,6 +235,19 @@ func (l *Logger) RecordRequest(id string, req *http.Request, source SourceType)
 	}
 	l.entries[id] = entry
 
+	if stream && req.Body != nil && req.Body != http.NoBody {
+		head := hreq.Raw
+		req.Body = newTeeBody(req.Body, func(c *capture) {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+
+			hreq.Raw = frameBody(head, c.mem.Bytes())
+			hreq.BodySize = c.size
+			hreq.BodyFile = c.spillFile()
+			hreq.Truncated = c.truncated
+		})
+	}
+
 	return nil
 }
 
@@ -162,6 +255,11 @@ func (l *Logger) RecordRequest(id string, req *http.Request, source SourceType)
 // is returned (and req.Body may be in an intermediate state) if an error is
 // returned from req.Body.Read.
 func NewRequest(req *http.Request) (*Request, error) {
+	return newRequest(req, true)
+}
+
+// newRequest builds a Request, leaving the body out of Raw when body isn't set
+func newRequest(req *http.Request, body bool) (*Request, error) {
 	r := &Request{
 		Method:      req.Method,
 		URL:         req.URL.String(),
@@ -170,7 +268,7 @@ func NewRequest(req *http.Request) (*Request, error) {
 		Host:        req.URL.Host,
 	}
 
-	raw, err := httputil.DumpRequestOut(req, true)
+	raw, err := httputil.DumpRequestOut(req, body)
 	if err != nil {
 		return nil, err
 	}
@@ -184,11 +282,64 @@ func (l *Logger) ModifyResponse(res *http.Response) error {
 	ctx := martian.NewContext(res.Request)
 	id := ctx.ID()
 
-	e := l.RecordResponse(id, res)
+	// a hijacked connection, such as a dropped request's, never gets a response
+	if ctx.Session().Hijacked() {
+		return nil
+	}
 
-	l.proxynotificationchan <- Notification{id, 1}
+	return l.streamResponse(id, res, networkState(ctx))
+}
 
-	return e
+// streamResponse logs a response whose body is captured as it's passed on to the client.
+// The entry is completed, and the proxy notified, once the body has been read. ns holds
+// the request's network conditions, which may truncate the body, and may be nil.
+func (l *Logger) streamResponse(id string, res *http.Response, ns *netState) error {
+	hres, err := newResponse(res, false)
+	if err != nil {
+		return err
+	}
+
+	done := func(c *capture) {
+		l.mu.Lock()
+		e, ok := l.entries[id]
+		if ok {
+			if c != nil {
+				hres.Raw = frameBody(hres.Raw, c.mem.Bytes())
+				hres.BodySize = c.size
+				hres.BodyFile = c.spillFile()
+				hres.Truncated = c.truncated
+			}
+			e.Response = hres
+			if ns != nil && ns.fault != "" {
+				e.Fault = ns.fault
+			}
+			l.complete(e)
+		}
+		l.mu.Unlock()
+
+		if ok {
+			l.responded(id)
+		}
+		l.proxynotificationchan <- Notification{id, 1}
+	}
+
+	// 101 bodies are the upgraded connection, leave them alone
+	if res.Body == nil || res.Body == http.NoBody || res.StatusCode == http.StatusSwitchingProtocols || res.Request.Method == http.MethodHead {
+		done(nil)
+		return nil
+	}
+
+	res.Body = newTeeBody(res.Body, done)
+	return nil
+}
+
+// complete records how long an entry took, once its response has been read. Callers hold l.mu.
+func (l *Logger) complete(e *Entry) {
+	e.Time = time.Since(e.StartedDateTime).Nanoseconds() / 1000000
+
+	if e.Conn != nil && e.Conn.Timings != nil && !e.Conn.Timings.firstByte.IsZero() {
+		e.Conn.Timings.Transfer = time.Since(e.Conn.Timings.firstByte)
+	}
 }
 
 // RecordResponse logs an HTTP response, associating it with the previously-logged
@@ -200,18 +351,87 @@ func (l *Logger) RecordResponse(id string, res *http.Response) error {
 	}
 
 	l.mu.Lock()
-	defer l.mu.Unlock()
-
-	if e, ok := l.entries[id]; ok {
+	e, ok := l.entries[id]
+	if ok {
 		e.Response = hres
-		e.Time = time.Since(e.StartedDateTime).Nanoseconds() / 1000000
+		l.complete(e)
 	}
+	l.mu.Unlock()
 
+	if ok {
+		l.responded(id)
+	}
 	return nil
 }
 
+// SetResponseHook - have f called with a copy of each entry once its response is
+// complete, such as to scan it. f is called without the logger locked and shouldn't block
+func (l *Logger) SetResponseHook(f func(e *Entry)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.responseHook = f
+}
+
+// SetResetHook - have f called after the entries are cleared by Reset, such as to drop
+// what was found in them
+func (l *Logger) SetResetHook(f func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.resetHook = f
+}
+
+// responded - hand the response hook a copy of the entry, taken under the lock, as the
+// logger goes on updating the entry itself
+func (l *Logger) responded(id string) {
+	l.mu.Lock()
+	hook := l.responseHook
+	var e *Entry
+	if entry, ok := l.entries[id]; ok && hook != nil {
+		e = entry.copy()
+	}
+	l.mu.Unlock()
+
+	if e != nil {
+		hook(e)
+	}
+}
+
+// copy - the entry with its own request and response, so updates to either aren't
+// seen through it. Callers hold l.mu.
+func (e *Entry) copy() *Entry {
+	c := *e
+	if e.Request != nil {
+		r := *e.Request
+		c.Request = &r
+	}
+	if e.Response != nil {
+		r := *e.Response
+		c.Response = &r
+	}
+	c.Findings = slices.Clone(e.Findings)
+	return &c
+}
+
+// SetFault records the failure a network rule injected into an entry that didn't go
+// through the proxy, such as one captured from a browser.
+func (l *Logger) SetFault(id string, fault string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if e, ok := l.entries[id]; ok {
+		e.Fault = fault
+	}
+}
+
 // NewResponse constructs and returns a Response from resp.
 func NewResponse(res *http.Response) (*Response, error) {
+	return newResponse(res, true)
+}
+
+// newResponse builds a Response, leaving the body out of Raw when body isn't set
+func newResponse(res *http.Response, body bool) (*Response, error) {
 	r := &Response{
 		HTTPVersion: res.Proto,
 		Status:      res.StatusCode,
@@ -220,7 +440,7 @@ func NewResponse(res *http.Response) (*Response, error) {
 		Headers:     res.Header.Clone(),
 	}
 
-	raw, err := httputil.DumpResponse(res, true)
+	raw, err := httputil.DumpResponse(res, body)
 	if err != nil {
 		return nil, err
 	}
@@ -283,13 +503,69 @@ func (l *Logger) InjectResponse(id string, res *http.Response) error {
 	return nil
 }
 
-// Reset clears the in-memory log of entries.
+// RecordTunnel logs a CONNECT request that is being passed through without interception
+// as a connection-level entry and sends proxy notifications.
+func (l *Logger) RecordTunnel(id string, req *http.Request) error {
+	err := l.RecordRequest(id, req, SourceTunnel)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.entries[id].Request.URL = req.URL.Host
+	if ctx := martian.NewContext(req); ctx != nil {
+		l.entries[id].Tag = sessionTag(ctx)
+	}
+	l.mu.Unlock()
+
+	l.proxynotificationchan <- Notification{id, 0}
+	return nil
+}
+
+// CloseTunnel completes a tunnel entry once the connection closes. The response records
+// how many bytes went each way and the error that ended the tunnel, if there was one.
+func (l *Logger) CloseTunnel(id string, sent, received int64, tunnelErr error) error {
+	body := fmt.Sprintf("Passthrough tunnel closed\nSent:     %d bytes\nReceived: %d bytes\n", sent, received)
+	if tunnelErr != nil {
+		body += fmt.Sprintf("Error:    %s\n", tunnelErr)
+	}
+
+	res := &http.Response{
+		Status:        "200 Connection Established",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"text/plain"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+
+	return l.InjectResponse(id, res)
+}
+
+// Reset clears the in-memory log of entries, and removes the temp files their spilled
+// bodies were in. The reset hook is called once they're gone.
 func (l *Logger) Reset() {
 	l.mu.Lock()
-	defer l.mu.Unlock()
+
+	for _, e := range l.entries {
+		if e.Request != nil && e.Request.BodyFile != "" {
+			removeSpill(e.Request.BodyFile)
+		}
+		if e.Response != nil && e.Response.BodyFile != "" {
+			removeSpill(e.Response.BodyFile)
+		}
+	}
 
 	l.entries = make(map[string]*Entry)
 	l.wsEntries = make(map[string]*WebSocketEntry)
+	hook := l.resetHook
+	l.mu.Unlock()
+
+	if hook != nil {
+		hook()
+	}
 }
 
 // Lock the mutex
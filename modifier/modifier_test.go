@@ -0,0 +1,39 @@
+package modifier
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLoggerHooks(t *testing.T) {
+	l := NewLogger(nil, nil, nil, nil)
+
+	var got *Entry
+	reset := false
+	l.SetResponseHook(func(e *Entry) { got = e })
+	l.SetResetHook(func() { reset = true })
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	if err := l.RecordRequest("1", req, SourceProxy); err != nil {
+		t.Fatal(err)
+	}
+	res := &http.Response{StatusCode: http.StatusOK, ProtoMajor: 1, ProtoMinor: 1, Header: http.Header{}, Body: http.NoBody, Request: req}
+	if err := l.RecordResponse("1", res); err != nil {
+		t.Fatal(err)
+	}
+
+	e := l.GetEntry("1")
+	if got == nil || got == e || got.Request == e.Request || got.Response == e.Response {
+		t.Fatalf("TestLoggerHooks got %p want a copy of %p", got, e)
+	}
+	if !strings.HasPrefix(string(got.Response.Raw), "HTTP/1.1 200") {
+		t.Errorf("TestLoggerHooks response got %q want a 200", got.Response.Raw)
+	}
+
+	l.Reset()
+	if !reset || l.GetEntry("1") != nil {
+		t.Errorf("TestLoggerHooks after Reset got hook called %v entry %v want true nil", reset, l.GetEntry("1"))
+	}
+}
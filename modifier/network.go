@@ -0,0 +1,296 @@
+package modifier
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Network - rules simulating bad networks for matching requests, with added latency,
+// capped bandwidth and injected failures
+var Network = NewRules(parseConditions)
+
+// conditions - what a network rule does to the requests it matches. Probabilities are
+// between 0 and 1
+type conditions struct {
+	latency   time.Duration // added before the request is sent
+	bandwidth int64         // bytes per second each way, 0 for no cap
+	reset     float64       // chance the client connection is reset instead of answered
+	truncate  float64       // chance the response body is cut short
+	fail      float64       // chance the request is answered with status instead
+	status    int
+}
+
+// parseConditions - a comma separated list of latency=duration, bandwidth=bytes per
+// second (k and m suffixes allowed), and reset, truncate and error probabilities, with
+// status setting the code injected errors use. example: latency=300ms,bandwidth=64k,error=0.1
+func parseConditions(value string) (any, error) {
+	c := &conditions{status: http.StatusServiceUnavailable}
+
+	for _, opt := range strings.Split(value, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(opt), "=")
+		if !ok {
+			return nil, errors.New("bad network condition " + opt + ", expected name=value such as latency=300ms")
+		}
+
+		var err error
+		switch strings.ToLower(k) {
+		case "latency":
+			c.latency, err = time.ParseDuration(v)
+		case "bandwidth":
+			c.bandwidth, err = parseRate(v)
+		case "reset":
+			c.reset, err = parseProbability(v)
+		case "truncate":
+			c.truncate, err = parseProbability(v)
+		case "error":
+			c.fail, err = parseProbability(v)
+		case "status":
+			c.status, err = strconv.Atoi(v)
+			if err == nil && (c.status < 500 || c.status > 599) {
+				err = errors.New("expected a 5xx status")
+			}
+		default:
+			return nil, errors.New("unknown network condition " + k + ", expected latency, bandwidth, reset, truncate, error or status")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("bad network condition %s: %w", opt, err)
+		}
+	}
+
+	return c, nil
+}
+
+// parseRate - bytes per second, with an optional k or m suffix for KiB and MiB
+func parseRate(s string) (int64, error) {
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(strings.ToLower(s), "k"):
+		mult, s = 1<<10, s[:len(s)-1]
+	case strings.HasSuffix(strings.ToLower(s), "m"):
+		mult, s = 1<<20, s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, errors.New("expected a positive number of bytes per second")
+	}
+	return n * mult, nil
+}
+
+// parseProbability - a number between 0 and 1, or a percentage
+func parseProbability(s string) (float64, error) {
+	div := 1.0
+	if p, ok := strings.CutSuffix(s, "%"); ok {
+		s, div = p, 100
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f < 0 || f/div > 1 {
+		return 0, errors.New("expected a probability between 0 and 1, or a percentage")
+	}
+	return f / div, nil
+}
+
+// netState - a request's network conditions, and the failure injected into it if any
+type netState struct {
+	*conditions
+	fault string
+	abort bool // reset the client connection rather than answering
+}
+
+// martian context key holding the request's netState
+const networkKey = "glorp.network"
+
+// netRequest - apply a network rule's latency and upload cap to req, and pick the
+// failure to inject up front when it's a reset or an error
+func netRequest(req *http.Request, c *conditions) *netState {
+	ns := &netState{conditions: c}
+
+	if c.latency > 0 {
+		time.Sleep(c.latency)
+	}
+
+	if c.bandwidth > 0 && req.Body != nil && req.Body != http.NoBody {
+		req.Body = newThrottle(req.Body, c.bandwidth)
+	}
+
+	ns.fault, ns.abort = c.roll()
+	return ns
+}
+
+// roll - pick the failure to inject up front, a reset or an error, if any
+func (c *conditions) roll() (fault string, abort bool) {
+	switch {
+	case chance(c.reset):
+		return "connection reset", true
+	case chance(c.fail):
+		return fmt.Sprintf("injected %d", c.status), false
+	}
+	return "", false
+}
+
+// NetworkConditions - what a network rule does to a request that doesn't go through the
+// proxy, such as one captured from a browser over CDP. The dice have already been rolled
+type NetworkConditions struct {
+	Latency   time.Duration // wait before sending the request
+	Bandwidth int64         // bytes per second, 0 for no cap
+	Reset     bool          // fail the request as if the connection was reset
+	Status    int           // answer the request with this status instead, 0 to send it
+	Truncate  bool          // cut the response body short
+	Fault     string        // the failure injected, recorded on the entry
+}
+
+// MatchNetwork - the network conditions for a request to u, false when no rule matches
+func MatchNetwork(u *url.URL) (*NetworkConditions, bool) {
+	rl, ok := Network.match(u)
+	if !ok {
+		return nil, false
+	}
+
+	c := rl.value.(*conditions)
+	nc := &NetworkConditions{Latency: c.latency, Bandwidth: c.bandwidth}
+	nc.Fault, nc.Reset = c.roll()
+	if nc.Fault != "" && !nc.Reset {
+		nc.Status = c.status
+	}
+	nc.Truncate = nc.Fault == "" && chance(c.truncate)
+	return nc, true
+}
+
+// Cut - truncate a response body at a random point, recording the fault
+func (nc *NetworkConditions) Cut(body []byte) []byte {
+	if len(body) == 0 {
+		return body
+	}
+	n := rand.IntN(len(body))
+	nc.Fault = fmt.Sprintf("truncated after %d bytes", n)
+	return body[:n]
+}
+
+// Throttle - wait as long as n bytes take to arrive at the capped bandwidth
+func (nc *NetworkConditions) Throttle(n int) {
+	if nc.Bandwidth > 0 {
+		time.Sleep(time.Duration(int64(n) * int64(time.Second) / nc.Bandwidth))
+	}
+}
+
+// netResponse - apply the download cap to res, and truncate its body when the dice say so
+func netResponse(res *http.Response, ns *netState) {
+	if ns.bandwidth > 0 {
+		res.Body = newThrottle(res.Body, ns.bandwidth)
+	}
+
+	if !chance(ns.truncate) || res.Request.Method == http.MethodHead {
+		return
+	}
+
+	// cut somewhere in the body, or in the first 32KB when its length isn't known. Shorter
+	// bodies of unknown length lose their end instead, such as the last chunk
+	size := res.ContentLength
+	if size < 0 {
+		size = 32 << 10
+	}
+	if size == 0 {
+		return
+	}
+
+	res.Body = &truncateBody{ReadCloser: res.Body, left: rand.Int64N(size), ns: ns}
+	// the client can only tell the body was cut short if the connection ends with it
+	res.Close = true
+}
+
+func chance(p float64) bool {
+	return p > 0 && rand.Float64() < p
+}
+
+// errTruncated - ends a truncated body. It isn't io.EOF, so chunked bodies are written
+// without their terminating chunk
+var errTruncated = errors.New("response truncated by network condition rule")
+
+// truncateBody - a body cut short after left more bytes
+type truncateBody struct {
+	io.ReadCloser
+	left int64
+	read int64
+	ns   *netState
+}
+
+func (t *truncateBody) Read(p []byte) (int, error) {
+	if t.left <= 0 {
+		return 0, t.cut()
+	}
+
+	if int64(len(p)) > t.left {
+		p = p[:t.left]
+	}
+	n, err := t.ReadCloser.Read(p)
+	t.left -= int64(n)
+	t.read += int64(n)
+	if err == io.EOF {
+		t.left = 0
+		return n, t.cut()
+	}
+	return n, err
+}
+
+func (t *truncateBody) cut() error {
+	t.ns.fault = fmt.Sprintf("truncated after %d bytes", t.read)
+	return errTruncated
+}
+
+// throttle - a body read no faster than rate bytes per second
+type throttle struct {
+	io.ReadCloser
+	rate  int64
+	start time.Time
+	read  int64
+}
+
+func newThrottle(body io.ReadCloser, rate int64) *throttle {
+	return &throttle{ReadCloser: body, rate: rate}
+}
+
+func (t *throttle) Read(p []byte) (int, error) {
+	if t.start.IsZero() {
+		t.start = time.Now()
+	}
+
+	// small reads keep the rate smooth, about ten a second
+	if chunk := max(t.rate/10, 1); int64(len(p)) > chunk {
+		p = p[:chunk]
+	}
+
+	n, err := t.ReadCloser.Read(p)
+	t.read += int64(n)
+
+	due := time.Duration(t.read * int64(time.Second) / t.rate)
+	if wait := due - time.Since(t.start); wait > 0 {
+		time.Sleep(wait)
+	}
+	return n, err
+}
+
+// resetConn - abort a client connection with a RST. Reads are shut down rather than the
+// connection closed, so martian sees EOF and closes it, and the zero linger turns that
+// close into a reset
+func resetConn(conn net.Conn) error {
+	raw := conn
+	if c, ok := raw.(interface{ NetConn() net.Conn }); ok {
+		raw = c.NetConn()
+	}
+
+	tcp, ok := raw.(*net.TCPConn)
+	if !ok {
+		return conn.Close()
+	}
+	tcp.SetLinger(0)
+	return tcp.CloseRead()
+}
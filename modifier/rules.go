@@ -0,0 +1,359 @@
+package modifier
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/google/martian/v3"
+)
+
+// urlPattern - matches request URLs by [scheme://]host[:port][/path]. The host may use
+// shell style wildcards, the path matches itself and anything below it, or anything
+// starting with it when it ends in *
+type urlPattern struct {
+	scheme string
+	host   string
+	port   string
+	path   string
+}
+
+func parseURLPattern(s string) (urlPattern, error) {
+	var p urlPattern
+
+	s = strings.TrimSpace(s)
+	if scheme, rest, ok := strings.Cut(s, "://"); ok {
+		p.scheme = strings.ToLower(scheme)
+		s = rest
+		if p.scheme != "http" && p.scheme != "https" {
+			return p, errors.New("bad pattern scheme " + scheme)
+		}
+	}
+
+	host := s
+	if i := strings.Index(s, "/"); i != -1 {
+		host, p.path = s[:i], s[i:]
+	}
+
+	if i := strings.LastIndex(host, ":"); i != -1 && !strings.HasSuffix(host, "]") {
+		host, p.port = host[:i], host[i+1:]
+		if p.port == "" {
+			return p, errors.New("empty pattern port")
+		}
+	}
+	p.host = strings.ToLower(strings.Trim(host, "[]"))
+
+	if p.host == "" {
+		return p, errors.New("empty pattern host")
+	}
+	if _, err := path.Match(p.host, ""); err != nil {
+		return p, errors.New("bad pattern host " + p.host)
+	}
+
+	return p, nil
+}
+
+// String - the pattern in the form it was parsed from
+func (p urlPattern) String() string {
+	s := p.host
+	if strings.Contains(s, ":") {
+		s = "[" + s + "]"
+	}
+	if p.port != "" {
+		s += ":" + p.port
+	}
+	if p.scheme != "" {
+		s = p.scheme + "://" + s
+	}
+	return s + p.path
+}
+
+func (p urlPattern) match(u *url.URL) bool {
+	if p.scheme != "" && p.scheme != u.Scheme {
+		return false
+	}
+
+	if ok, _ := path.Match(p.host, strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))); !ok {
+		return false
+	}
+
+	if p.port != "" {
+		port := u.Port()
+		if port == "" {
+			port = defaultPort(u.Scheme)
+		}
+		if port != p.port {
+			return false
+		}
+	}
+
+	if prefix, ok := strings.CutSuffix(p.path, "*"); ok {
+		return strings.HasPrefix(u.Path, prefix)
+	}
+	dir := strings.TrimSuffix(p.path, "/")
+	return dir == "" || u.Path == dir || strings.HasPrefix(u.Path, dir+"/")
+}
+
+// rest - the part of a matching URL path after the pattern's path
+func (p urlPattern) rest(urlPath string) string {
+	prefix, ok := strings.CutSuffix(p.path, "*")
+	if !ok {
+		prefix = strings.TrimSuffix(prefix, "/")
+	}
+	return strings.TrimPrefix(urlPath, prefix)
+}
+
+func defaultPort(scheme string) string {
+	if scheme == "https" {
+		return "443"
+	}
+	return "80"
+}
+
+// Rule - a URL pattern and what to do with the requests it matches
+type Rule struct {
+	Pattern string
+	Value   string
+}
+
+type rule struct {
+	Rule
+	pattern urlPattern
+	value   any // Value, parsed by the table's parse function
+}
+
+// Rules - an ordered table of URL pattern rules, the first match wins. Safe to edit
+// while requests are handled
+type Rules struct {
+	mu    sync.RWMutex
+	rules []rule
+	parse func(value string) (any, error)
+}
+
+// NewRules - an empty table, parse checks a rule's value and returns what the rule
+// uses at request time
+func NewRules(parse func(value string) (any, error)) *Rules {
+	return &Rules{parse: parse}
+}
+
+// Set - add a rule to the end of the table, or change the value of an existing one
+func (r *Rules) Set(pattern, value string) error {
+	p, err := parseURLPattern(pattern)
+	if err != nil {
+		return err
+	}
+
+	value = strings.TrimSpace(value)
+	v, err := r.parse(value)
+	if err != nil {
+		return err
+	}
+	rl := rule{Rule{p.String(), value}, p, v}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.rules {
+		if r.rules[i].Pattern == rl.Pattern {
+			r.rules[i] = rl
+			return nil
+		}
+	}
+	r.rules = append(r.rules, rl)
+	return nil
+}
+
+// canonical - pattern in the form rules are stored under
+func canonical(pattern string) string {
+	if p, err := parseURLPattern(pattern); err == nil {
+		return p.String()
+	}
+	return pattern
+}
+
+// Remove - remove the rule for pattern
+func (r *Rules) Remove(pattern string) {
+	pattern = canonical(pattern)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.rules {
+		if r.rules[i].Pattern == pattern {
+			r.rules = append(r.rules[:i], r.rules[i+1:]...)
+			return
+		}
+	}
+}
+
+// Move - move the rule for pattern up (negative) or down (positive) the table
+func (r *Rules) Move(pattern string, by int) {
+	pattern = canonical(pattern)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.rules {
+		if r.rules[i].Pattern == pattern {
+			j := min(max(i+by, 0), len(r.rules)-1)
+			rl := r.rules[i]
+			r.rules = append(r.rules[:i], r.rules[i+1:]...)
+			r.rules = append(r.rules[:j], append([]rule{rl}, r.rules[j:]...)...)
+			return
+		}
+	}
+}
+
+// List - the current rules, in match order
+func (r *Rules) List() []Rule {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rules := make([]Rule, len(r.rules))
+	for i, rl := range r.rules {
+		rules[i] = rl.Rule
+	}
+	return rules
+}
+
+// match - the first rule matching u
+func (r *Rules) match(u *url.URL) (rule, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, rl := range r.rules {
+		if rl.pattern.match(u) {
+			return rl, true
+		}
+	}
+	return rule{}, false
+}
+
+// martian context keys holding what the rules decided for a request
+const (
+	mapLocalKey = "glorp.maplocal" // the local file the request is answered from
+	blockKey    = "glorp.block"    // the block rule's action
+)
+
+// RuleModifier - applies the network, block and map rules to proxied requests. It goes
+// ahead of the logger, so the history shows what the client actually got
+type RuleModifier struct{}
+
+// ModifyRequest - apply network conditions, skip the round trip for requests that are
+// failed, blocked or answered locally, and point requests matching a Map Remote rule at
+// their new destination
+func (m *RuleModifier) ModifyRequest(req *http.Request) error {
+	if req.Method == http.MethodConnect {
+		return nil
+	}
+
+	ctx := martian.NewContext(req)
+	if ctx == nil {
+		return nil
+	}
+
+	if rl, ok := Network.match(req.URL); ok {
+		ns := netRequest(req, rl.value.(*conditions))
+		ctx.Set(networkKey, ns)
+		if ns.fault != "" {
+			ctx.SkipRoundTrip()
+			return nil
+		}
+	}
+
+	if rl, ok := Blocks.match(req.URL); ok {
+		ctx.Set(blockKey, rl.value)
+		ctx.SkipRoundTrip()
+		return nil
+	}
+
+	if rl, ok := MapLocal.match(req.URL); ok {
+		ctx.Set(mapLocalKey, localFile(rl, req.URL.Path))
+		ctx.SkipRoundTrip()
+		return nil
+	}
+
+	if rl, ok := MapRemote.match(req.URL); ok {
+		mapRemote(req, rl.pattern, rl.value.(*url.URL))
+	}
+
+	return nil
+}
+
+// ModifyResponse - fill in the responses of requests that are failed, blocked or answered
+// locally, and apply network conditions. Reset and dropped requests have their
+// connection closed instead
+func (m *RuleModifier) ModifyResponse(res *http.Response) error {
+	ctx := martian.NewContext(res.Request)
+	if ctx == nil {
+		return nil
+	}
+
+	ns := networkState(ctx)
+	if ns != nil && ns.fault != "" {
+		drainRequest(res.Request)
+
+		if ns.abort {
+			conn, _, err := ctx.Session().Hijack()
+			if err != nil {
+				return err
+			}
+			return resetConn(conn)
+		}
+
+		(&blockAction{status: ns.status, body: http.StatusText(ns.status) + "\n"}).respond(res)
+		return nil
+	}
+
+	if ns != nil {
+		defer netResponse(res, ns)
+	}
+
+	if v, ok := ctx.Get(blockKey); ok {
+		// the request never goes upstream, read its body so it's still recorded
+		drainRequest(res.Request)
+
+		block := v.(*blockAction)
+		if !block.drop {
+			block.respond(res)
+			return nil
+		}
+
+		conn, _, err := ctx.Session().Hijack()
+		if err != nil {
+			return err
+		}
+		// half close, so the client sees the connection end and martian's next read gets EOF
+		if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+			return cw.CloseWrite()
+		}
+		return conn.Close()
+	}
+
+	if file, ok := ctx.Get(mapLocalKey); ok {
+		drainRequest(res.Request)
+		serveLocal(res, file.(string))
+	}
+
+	return nil
+}
+
+// networkState - the network conditions applied to a request, nil when no rule matched
+func networkState(ctx *martian.Context) *netState {
+	if v, ok := ctx.Get(networkKey); ok {
+		return v.(*netState)
+	}
+	return nil
+}
+
+// drainRequest - read and close the body of a request that isn't sent upstream
+func drainRequest(req *http.Request) {
+	if req.Body != nil {
+		io.Copy(io.Discard, req.Body)
+		req.Body.Close()
+	}
+}
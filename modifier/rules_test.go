@@ -0,0 +1,143 @@
+package modifier
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestURLPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		url     string
+		want    bool
+	}{
+		{"example.com", "https://example.com/anything", true},
+		{"*.example.com/static", "https://cdn.example.com/static/app.js", true},
+		{"*.example.com/static", "https://cdn.example.com/staticfoo", false},
+		{"*.example.com/static*", "https://cdn.example.com/staticfoo", true},
+		{"http://example.com", "https://example.com/", false},
+		{"example.com:443", "https://example.com/", true},
+		{"example.com:8443", "https://example.com/", false},
+	}
+
+	for _, tt := range tests {
+		p, err := parseURLPattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("parseURLPattern(%s) got %v", tt.pattern, err)
+		}
+		u, _ := url.Parse(tt.url)
+		if got := p.match(u); got != tt.want {
+			t.Errorf("%s match %s got %v want %v", tt.pattern, tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestMapRemote(t *testing.T) {
+	tests := []struct {
+		pattern string
+		to      string
+		url     string
+		want    string
+	}{
+		{"api.example.com/v1", "http://localhost:3000/v2", "https://api.example.com/v1/users?id=1", "http://localhost:3000/v2/users?id=1"},
+		{"api.example.com", "http://localhost:3000", "https://api.example.com/v1/users", "http://localhost:3000/v1/users"},
+		{"api.example.com/v1", "http://localhost:3000/", "https://api.example.com/v1", "http://localhost:3000/"},
+	}
+
+	for _, tt := range tests {
+		r := NewRules(parseMapRemote)
+		if err := r.Set(tt.pattern, tt.to); err != nil {
+			t.Fatalf("Set(%s, %s) got %v", tt.pattern, tt.to, err)
+		}
+
+		req := httptest.NewRequest("GET", tt.url, nil)
+		rl, ok := r.match(req.URL)
+		if !ok {
+			t.Fatalf("%s didn't match %s", tt.pattern, tt.url)
+		}
+		mapRemote(req, rl.pattern, rl.value.(*url.URL))
+
+		if got := req.URL.String(); got != tt.want || req.Host != req.URL.Host {
+			t.Errorf("mapRemote(%s) got %s Host %s want %s", tt.url, got, req.Host, tt.want)
+		}
+	}
+}
+
+func TestBlockRespond(t *testing.T) {
+	tests := []struct {
+		action string
+		status int
+		body   string
+		drop   bool
+	}{
+		{"drop", 0, "", true},
+		{"204", 204, "", false},
+		{"403 blocked by glorp", 403, "blocked by glorp", false},
+	}
+
+	for _, tt := range tests {
+		v, err := parseBlock(tt.action)
+		if err != nil {
+			t.Fatalf("parseBlock(%s) got %v", tt.action, err)
+		}
+		b := v.(*blockAction)
+		if b.drop != tt.drop {
+			t.Errorf("parseBlock(%s) drop got %v want %v", tt.action, b.drop, tt.drop)
+		}
+		if b.drop {
+			continue
+		}
+
+		res := &http.Response{Header: make(http.Header)}
+		b.respond(res)
+		body, _ := io.ReadAll(res.Body)
+		if res.StatusCode != tt.status || string(body) != tt.body {
+			t.Errorf("respond(%s) got %d %q want %d %q", tt.action, res.StatusCode, body, tt.status, tt.body)
+		}
+	}
+
+	if _, err := parseBlock("blocked"); err == nil {
+		t.Errorf("parseBlock(blocked) got nil want error")
+	}
+}
+
+func TestParseConditions(t *testing.T) {
+	v, err := parseConditions("latency=300ms, bandwidth=64k,error=5%,status=502")
+	if err != nil {
+		t.Fatalf("parseConditions got %v", err)
+	}
+
+	got := *v.(*conditions)
+	want := conditions{latency: 300 * time.Millisecond, bandwidth: 64 << 10, fail: 0.05, status: 502}
+	if got != want {
+		t.Errorf("parseConditions got %+v want %+v", got, want)
+	}
+
+	for _, bad := range []string{"latency", "reset=2", "status=404", "jitter=10ms"} {
+		if _, err := parseConditions(bad); err == nil {
+			t.Errorf("parseConditions(%s) got nil want error", bad)
+		}
+	}
+}
+
+func TestMatchNetwork(t *testing.T) {
+	defer Network.Remove("fail.example.com")
+	if err := Network.Set("fail.example.com", "latency=10ms,error=1,status=502"); err != nil {
+		t.Fatal(err)
+	}
+
+	u, _ := url.Parse("https://fail.example.com/x")
+	nc, ok := MatchNetwork(u)
+	if !ok || nc.Latency != 10*time.Millisecond || nc.Status != 502 || nc.Reset || nc.Fault != "injected 502" {
+		t.Errorf("TestMatchNetwork got %+v %v want a 502 after 10ms", nc, ok)
+	}
+
+	u, _ = url.Parse("https://other.example.com/")
+	if _, ok := MatchNetwork(u); ok {
+		t.Errorf("TestMatchNetwork matched a host without a rule")
+	}
+}
@@ -0,0 +1,166 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/google/martian/v3"
+)
+
+// authKey - martian session key marking a connection that sent valid proxy credentials
+const authKey = "glorp.authenticated"
+
+// ParseAllow - parse allow list entries, each an IP address or a CIDR range
+func ParseAllow(entries []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+
+		if !strings.Contains(e, "/") {
+			ip := net.ParseIP(e)
+			if ip == nil {
+				return nil, errors.New("bad allow entry " + e)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(e)
+		if err != nil {
+			return nil, errors.New("bad allow entry " + e)
+		}
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
+
+// allowListener - drops connections from addresses outside the allow list
+type allowListener struct {
+	net.Listener
+	allow []*net.IPNet
+}
+
+// Accept - the next connection from an allowed address
+func (al *allowListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := al.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		if allowed(al.allow, conn.RemoteAddr()) {
+			return conn, nil
+		}
+
+		log.Printf("[!] Refused connection from %s to %s, not in the allow list\n", conn.RemoteAddr(), conn.LocalAddr())
+		conn.Close()
+	}
+}
+
+func allowed(allow []*net.IPNet, addr net.Addr) bool {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return false
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, n := range allow {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyAuth - requires Basic Proxy-Authorization credentials before passing requests on
+// to next. A connection is trusted once it has sent valid credentials, as requests
+// inside an intercepted CONNECT tunnel don't carry them. Refused requests get a 407
+// and the connection is closed, so they never reach next and aren't logged
+type proxyAuth struct {
+	creds string // user:password
+	next  martian.RequestResponseModifier
+}
+
+// ModifyRequest - check the request's credentials. They're taken off every request,
+// as clients keep sending them on an authenticated connection and they'd otherwise be
+// forwarded upstream and logged
+func (a *proxyAuth) ModifyRequest(req *http.Request) error {
+	creds := req.Header.Get("Proxy-Authorization")
+	req.Header.Del("Proxy-Authorization")
+
+	ctx := martian.NewContext(req)
+	if ctx == nil {
+		return a.next.ModifyRequest(req)
+	}
+
+	session := ctx.Session()
+	if v, _ := session.Get(authKey); v == true {
+		return a.next.ModifyRequest(req)
+	}
+
+	if a.check(creds) {
+		session.Set(authKey, true)
+		return a.next.ModifyRequest(req)
+	}
+
+	conn, brw, err := session.Hijack()
+	if err != nil {
+		return err
+	}
+
+	if creds != "" {
+		log.Printf("[!] Refused %s %s from %s, bad proxy credentials\n", req.Method, req.URL, conn.RemoteAddr())
+	}
+
+	res := &http.Response{
+		StatusCode: http.StatusProxyAuthRequired,
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Proxy-Authenticate": []string{`Basic realm="glorp"`},
+			"Connection":         []string{"close"},
+		},
+	}
+	res.Write(brw)
+	brw.Flush()
+	closeWrite(conn)
+
+	return nil
+}
+
+// ModifyResponse - hijacked sessions never get a response, so everything here is authenticated
+func (a *proxyAuth) ModifyResponse(res *http.Response) error {
+	return a.next.ModifyResponse(res)
+}
+
+func (a *proxyAuth) check(header string) bool {
+	scheme, value, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Basic") {
+		return false
+	}
+
+	creds, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare(creds, []byte(a.creds)) == 1
+}
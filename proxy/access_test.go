@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAllow(t *testing.T) {
+	allow, err := ParseAllow([]string{"10.0.0.0/8", " 192.168.1.5 ", "fd00::/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]bool{
+		"10.1.2.3":    true,
+		"192.168.1.5": true,
+		"192.168.1.6": false,
+		"127.0.0.1":   false,
+		"fd00::1":     true,
+		"::1":         false,
+	}
+	for ip, want := range tests {
+		if got := allowed(allow, &net.TCPAddr{IP: net.ParseIP(ip), Port: 1234}); got != want {
+			t.Errorf("TestAllow %s got %v want %v", ip, got, want)
+		}
+	}
+
+	// a refused connection is closed without being handed on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	al := &allowListener{Listener: l, allow: allow}
+	defer al.Close()
+	go al.Accept()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("TestAllow refused connection got %v want %v", err, io.EOF)
+	}
+}
+
+// recordModifier - stands in for the modifiers behind proxyAuth, counting the requests
+// that get through
+type recordModifier struct {
+	mu   sync.Mutex
+	reqs int
+}
+
+func (m *recordModifier) ModifyRequest(req *http.Request) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reqs++
+	return nil
+}
+
+func (m *recordModifier) ModifyResponse(res *http.Response) error {
+	return nil
+}
+
+func TestProxyAuth(t *testing.T) {
+	var mu sync.Mutex
+	var leaked []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		if v := r.Header.Get("Proxy-Authorization"); v != "" {
+			leaked = append(leaked, v)
+		}
+		mu.Unlock()
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	next := new(recordModifier)
+	auth := &proxyAuth{creds: "user:pass", next: next}
+	p := newMartian(nil)
+	p.SetRequestModifier(auth)
+	p.SetResponseModifier(auth)
+	defer p.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go p.Serve(l)
+
+	send := func(conn net.Conn, br *bufio.Reader, creds string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/", nil)
+		if creds != "" {
+			req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(creds)))
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		if err := req.WriteProxy(conn); err != nil {
+			t.Fatal(err)
+		}
+		res, err := http.ReadResponse(br, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.ReadAll(res.Body)
+		res.Body.Close()
+		return res
+	}
+
+	for _, creds := range []string{"", "user:wrong"} {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := send(conn, bufio.NewReader(conn), creds)
+		conn.Close()
+		if res.StatusCode != http.StatusProxyAuthRequired || res.Header.Get("Proxy-Authenticate") == "" {
+			t.Errorf("TestProxyAuth credentials %q got %d want %d with a challenge", creds, res.StatusCode, http.StatusProxyAuthRequired)
+		}
+	}
+
+	// browsers send the credentials on every request of a keep-alive connection
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	for i := range 2 {
+		if res := send(conn, br, "user:pass"); res.StatusCode != http.StatusOK {
+			t.Errorf("TestProxyAuth request %d got %d want %d", i, res.StatusCode, http.StatusOK)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(leaked) > 0 {
+		t.Errorf("TestProxyAuth upstream got Proxy-Authorization %q want none", leaked)
+	}
+	next.mu.Lock()
+	defer next.mu.Unlock()
+	if next.reqs != 2 {
+		t.Errorf("TestProxyAuth next got %d requests want 2", next.reqs)
+	}
+}
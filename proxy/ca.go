@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// file names used for the persisted CA
+const (
+	CACertFile = "ca.crt"
+	CAKeyFile  = "ca.key"
+)
+
+// DefaultCADir - the directory the generated CA is kept in, under the user's config dir
+func DefaultCADir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "glorp"), nil
+}
+
+// GenerateCA - create a self-signed CA certificate and RSA key. The certificate has a
+// common name, which iOS insists on, and is limited to signing certificates and CRLs
+func GenerateCA(name string, validity time.Duration) (*x509.Certificate, crypto.Signer, error) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pub, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyID := sha1.Sum(pub)
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   name,
+			Organization: []string{name},
+		},
+		SubjectKeyId:          keyID[:],
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	raw, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cert, err := x509.ParseCertificate(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cert, priv, nil
+}
+
+// WriteCA - write the CA certificate and key as PEM files into dir, the key is only
+// readable by the current user
+func WriteCA(dir string, cert *x509.Certificate, priv crypto.Signer) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	key, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, CAKeyFile), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0600); err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, CACertFile), CertPEM(cert), 0644)
+}
+
+// LoadCA - load a CA certificate and key from PEM files
+func LoadCA(certFile, keyFile string) (*x509.Certificate, crypto.Signer, error) {
+	tlsc, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cert, err := x509.ParseCertificate(tlsc.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	priv, ok := tlsc.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, nil, errors.New("unsupported private key type")
+	}
+
+	return cert, priv, nil
+}
+
+// LoadOrCreateCA - load the CA kept in dir, generating and saving a new one if there
+// isn't one yet
+func LoadOrCreateCA(dir string) (*x509.Certificate, crypto.Signer, error) {
+	certFile := filepath.Join(dir, CACertFile)
+	keyFile := filepath.Join(dir, CAKeyFile)
+
+	if _, err := os.Stat(certFile); err == nil {
+		return LoadCA(certFile, keyFile)
+	}
+
+	cert, priv, err := GenerateCA("Glorp CA", 5*365*24*time.Hour)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := WriteCA(dir, cert, priv); err != nil {
+		return nil, nil, err
+	}
+
+	log.Printf("[+] Generated a new CA in %s\n", dir)
+	return cert, priv, nil
+}
+
+// CertPEM - the certificate PEM encoded
+func CertPEM(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+// CertFingerprint - the hex SHA256 fingerprint of the certificate
+func CertFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
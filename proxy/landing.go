@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/google/martian/v3"
+)
+
+// LandingHost - the magic hostname that serves the CA certificate through the proxy
+const LandingHost = "glorp"
+
+// landingPage - serves the CA certificate and install instructions on http://glorp/.
+// Requests for the landing page never leave the proxy and aren't passed on to next,
+// so they don't show up in the proxy history
+type landingPage struct {
+	cert *x509.Certificate
+	next martian.RequestResponseModifier
+}
+
+func isLandingRequest(req *http.Request) bool {
+	return req != nil && req.URL.Hostname() == LandingHost
+}
+
+// ModifyRequest - skip the round trip for landing page requests
+func (l *landingPage) ModifyRequest(req *http.Request) error {
+	if !isLandingRequest(req) {
+		return l.next.ModifyRequest(req)
+	}
+
+	if ctx := martian.NewContext(req); ctx != nil {
+		ctx.SkipRoundTrip()
+	}
+	return nil
+}
+
+// ModifyResponse - fill in the landing page response
+func (l *landingPage) ModifyResponse(res *http.Response) error {
+	if !isLandingRequest(res.Request) {
+		return l.next.ModifyResponse(res)
+	}
+
+	var body []byte
+	res.StatusCode = http.StatusOK
+	res.Header = make(http.Header)
+
+	switch res.Request.URL.Path {
+	case "/", "/index.html":
+		res.Header.Set("Content-Type", "text/html; charset=utf-8")
+		body = l.index()
+	case "/ca.pem", "/ca.crt":
+		res.Header.Set("Content-Type", "application/x-pem-file")
+		res.Header.Set("Content-Disposition", `attachment; filename="glorp-ca.crt"`)
+		body = CertPEM(l.cert)
+	case "/ca.der", "/ca.cer":
+		res.Header.Set("Content-Type", "application/x-x509-ca-cert")
+		res.Header.Set("Content-Disposition", `attachment; filename="glorp-ca.cer"`)
+		body = l.cert.Raw
+	default:
+		res.StatusCode = http.StatusNotFound
+		res.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		body = []byte("Not found\n")
+	}
+
+	res.Status = strconv.Itoa(res.StatusCode) + " " + http.StatusText(res.StatusCode)
+	res.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	res.Header.Set("Cache-Control", "no-store")
+	res.ContentLength = int64(len(body))
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	return nil
+}
+
+func (l *landingPage) index() []byte {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Glorp CA</title></head>
+<body style="font-family: sans-serif; max-width: 40em; margin: auto; padding: 1em">
+<h1>Glorp CA</h1>
+<p>Install this certificate authority to intercept TLS traffic with Glorp.</p>
+<p><a href="/ca.der">Download the certificate (DER, .cer)</a><br>
+<a href="/ca.pem">Download the certificate (PEM, .crt)</a></p>
+<p>Subject: %s<br>Expires: %s<br>SHA256: <code style="word-break: break-all">%s</code></p>
+<h2>iOS</h2>
+<ol>
+<li>Open this page in Safari and download the DER certificate, then allow the configuration profile to be downloaded.</li>
+<li>Go to Settings &gt; General &gt; VPN &amp; Device Management, select the Glorp CA profile and install it.</li>
+<li>Go to Settings &gt; General &gt; About &gt; Certificate Trust Settings and enable full trust for the Glorp CA.</li>
+</ol>
+<h2>Android</h2>
+<ol>
+<li>Download the DER certificate.</li>
+<li>Go to Settings &gt; Security &gt; Encryption &amp; credentials &gt; Install a certificate &gt; CA certificate and pick the downloaded file.</li>
+<li>Apps targeting Android 7 or later only trust user CAs when their network security config allows it.</li>
+</ol>
+<h2>Firefox</h2>
+<ol>
+<li>Download the PEM certificate.</li>
+<li>Go to Settings &gt; Privacy &amp; Security &gt; Certificates &gt; View Certificates &gt; Authorities, import the file and trust it to identify websites.</li>
+</ol>
+<h2>Everything else</h2>
+<p>Import the certificate into the operating system or browser trust store as a trusted root CA.</p>
+</body></html>
+`, html.EscapeString(l.cert.Subject.String()), l.cert.NotAfter.Format("2006-01-02"), CertFingerprint(l.cert))
+
+	return b.Bytes()
+}
@@ -0,0 +1,327 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/denandz/glorp/modifier"
+
+	"github.com/google/martian/v3"
+	"github.com/google/martian/v3/mitm"
+)
+
+// listener modes
+const (
+	ModeExplicit    = "explicit"    // an ordinary HTTP proxy
+	ModeTransparent = "transparent" // also accepts clients that aren't proxy aware
+	ModeReverse     = "reverse"     // forwards every request to Upstream
+	ModeSOCKS5      = "socks5"      // a SOCKS5 proxy, streams are intercepted like HTTP CONNECT tunnels
+)
+
+// ListenerConfig - a proxy listener. Empty fields fall back to the proxy's Config
+type ListenerConfig struct {
+	Addr string // ip address to listen on
+	Port uint   // port to listen on
+	Mode string // explicit, transparent, reverse or socks5, defaults to explicit
+	Auth string // explicit and socks5 modes, user:password clients must authenticate with
+
+	Allow []string // IP addresses and CIDR ranges allowed to connect
+
+	Upstream string // reverse mode, where requests go. example: https://api.internal:8443
+	Name     string // reverse mode, hostname on the certificate served to HTTPS clients, defaults to the upstream's
+
+	Proxy string // downstream proxy, "direct" to not use the proxy's
+	Cert  string // CA certificate
+	Key   string // CA key
+	Tag   string // recorded on the entries of requests through this listener
+}
+
+// ParseListener - parse a listener in the [addr:]port[,option=value...] form used by the
+// -listen flag. The options are mode, auth, allow, tag, proxy, upstream, name, cert and
+// key. allow can be given more than once
+func ParseListener(s string) (ListenerConfig, error) {
+	var lc ListenerConfig
+
+	opts := strings.Split(s, ",")
+
+	port := opts[0]
+	if i := strings.LastIndex(port, ":"); i != -1 {
+		lc.Addr = strings.Trim(port[:i], "[]")
+		port = port[i+1:]
+	}
+
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || p == 0 {
+		return lc, errors.New("bad port " + port)
+	}
+	lc.Port = uint(p)
+
+	for _, opt := range opts[1:] {
+		k, v, found := strings.Cut(opt, "=")
+		if !found {
+			return lc, errors.New("expected option=value, got " + opt)
+		}
+
+		switch k {
+		case "mode":
+			lc.Mode = v
+		case "auth":
+			lc.Auth = v
+		case "allow":
+			lc.Allow = append(lc.Allow, v)
+		case "tag":
+			lc.Tag = v
+		case "proxy":
+			lc.Proxy = v
+		case "upstream":
+			lc.Upstream = v
+		case "name":
+			lc.Name = v
+		case "cert":
+			lc.Cert = v
+		case "key":
+			lc.Key = v
+		default:
+			return lc, errors.New("unknown listener option " + k)
+		}
+	}
+
+	switch lc.Mode {
+	case "":
+		lc.Mode = ModeExplicit
+	case ModeExplicit, ModeTransparent, ModeSOCKS5:
+	case ModeReverse:
+		if _, err := lc.upstreamURL(); err != nil {
+			return lc, err
+		}
+	default:
+		return lc, errors.New("unknown listener mode " + lc.Mode)
+	}
+
+	if lc.Auth != "" && ((lc.Mode != ModeExplicit && lc.Mode != ModeSOCKS5) || !strings.Contains(lc.Auth, ":")) {
+		return lc, errors.New("auth must be user:password, on an explicit or socks5 listener")
+	}
+
+	if _, err := ParseAllow(lc.Allow); err != nil {
+		return lc, err
+	}
+
+	if (lc.Cert == "") != (lc.Key == "") {
+		return lc, errors.New("cert and key must be given together")
+	}
+
+	if lc.Proxy != "" && lc.Proxy != "direct" {
+		if u, err := url.Parse(lc.Proxy); err != nil || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+			return lc, errors.New("proxy must be an http, https or socks5 URL, or direct")
+		}
+	}
+
+	return lc, nil
+}
+
+func (lc ListenerConfig) upstreamURL() (*url.URL, error) {
+	u, err := url.Parse(lc.Upstream)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("upstream must be an http or https URL, example: https://api.internal:8443")
+	}
+	return u, nil
+}
+
+// certName - the name on the certificate a reverse listener serves
+func (lc ListenerConfig) certName(upstream *url.URL) string {
+	if lc.Name != "" {
+		return lc.Name
+	}
+	return upstream.Hostname()
+}
+
+// tagModifier - store the listener's tag in the session, for the logger to record
+type tagModifier string
+
+// ModifyRequest - tag the request's session
+func (t tagModifier) ModifyRequest(req *http.Request) error {
+	if ctx := martian.NewContext(req); ctx != nil {
+		ctx.Session().Set(modifier.TagKey, string(t))
+	}
+	return nil
+}
+
+// handshakeListener - runs a handshake on each accepted connection, off the accept loop
+// so a slow client doesn't hold up the others. prepare returns the connection to hand
+// to martian, or nil when it closed the connection instead
+type handshakeListener struct {
+	net.Listener
+	prepare func(conn net.Conn) net.Conn
+
+	conns  chan net.Conn
+	errc   chan error
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newHandshakeListener(l net.Listener, prepare func(conn net.Conn) net.Conn) *handshakeListener {
+	hl := &handshakeListener{
+		Listener: l,
+		prepare:  prepare,
+		conns:    make(chan net.Conn),
+		errc:     make(chan error, 1),
+		closed:   make(chan struct{}),
+	}
+	go hl.acceptLoop()
+	return hl
+}
+
+// newTransparentListener - a listener for clients redirected with iptables and the like.
+// TLS is intercepted with a certificate for the ClientHello SNI, and martian takes the
+// destination from the Host header of origin-form requests. Proxy-aware clients still
+// work on the same listener, as their requests are plain HTTP. TLS connections whose
+// SNI is on the passthrough list are tunnelled to it untouched
+func newTransparentListener(l net.Listener, mc *mitm.Config, passthrough *passthroughModifier) *handshakeListener {
+	return newHandshakeListener(l, func(conn net.Conn) net.Conn {
+		// clients that don't send SNI get a certificate for the address they connected to
+		host, _, _ := net.SplitHostPort(conn.LocalAddr().String())
+		return sniffTLS(conn, mc.TLSForHost(host), passthrough)
+	})
+}
+
+func (hl *handshakeListener) acceptLoop() {
+	for {
+		conn, err := hl.Listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			hl.errc <- err
+			return
+		}
+
+		go func() {
+			c := hl.prepare(conn)
+			if c == nil {
+				return
+			}
+
+			select {
+			case hl.conns <- c:
+			case <-hl.closed:
+				c.Close()
+			}
+		}()
+	}
+}
+
+// Accept - the next connection that finished its handshake
+func (hl *handshakeListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-hl.conns:
+		return c, nil
+	case err := <-hl.errc:
+		return nil, err
+	case <-hl.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close - stop accepting connections
+func (hl *handshakeListener) Close() error {
+	hl.once.Do(func() { close(hl.closed) })
+	return hl.Listener.Close()
+}
+
+// sniffTLS - peek at the first byte and terminate TLS with cfg if it's a handshake,
+// anything else is handed to martian as is. martian marks requests read from a
+// *tls.Conn as https. When passthrough isn't nil, ClientHellos with an SNI on its list
+// are tunnelled to port 443 of that host before anything is sent back, and sniffTLS
+// returns nil. Redirected connections arrive on the listener's port, so like the
+// decrypted requests martian forwards, the tunnel assumes the client was after 443
+func sniffTLS(conn net.Conn, cfg *tls.Config, passthrough *passthroughModifier) net.Conn {
+	br := bufio.NewReader(conn)
+
+	conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+	b, err := br.Peek(1)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return nil
+	}
+
+	c := &bufferedConn{conn, br}
+
+	// 22 is the TLS handshake record type
+	if b[0] != 22 {
+		return c
+	}
+
+	hc := &helloConn{Conn: c, recording: passthrough != nil}
+	if passthrough != nil {
+		cfg.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			hc.recording = false
+			if hello.ServerName != "" && passthrough.Match(hello.ServerName) {
+				hc.sni = hello.ServerName
+				return nil, errTunnel
+			}
+			return nil, nil
+		}
+	}
+
+	tlsconn := tls.Server(hc, cfg)
+
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	err = tlsconn.Handshake()
+	conn.SetDeadline(time.Time{})
+
+	if errors.Is(err, errTunnel) {
+		passthrough.tunnel(&bufferedConn{conn, bufio.NewReader(io.MultiReader(&hc.hello, br))}, net.JoinHostPort(hc.sni, "443"))
+		return nil
+	}
+
+	if err != nil {
+		log.Printf("[!] TLS client handshake error for %s (SNI %q): %v\n", conn.RemoteAddr(), tlsconn.ConnectionState().ServerName, err)
+		conn.Close()
+		return nil
+	}
+
+	return tlsconn
+}
+
+// errTunnel - stops a handshake once the ClientHello's SNI is known
+var errTunnel = errors.New("tunnel")
+
+// helloConn - records what's read until the ClientHello is parsed, so it can be replayed
+// to a tunnel, and drops writes once a tunnel has been picked so the client doesn't see
+// the handshake being abandoned
+type helloConn struct {
+	net.Conn
+	hello     bytes.Buffer
+	recording bool
+	sni       string
+}
+
+func (c *helloConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if c.recording {
+		c.hello.Write(b[:n])
+	}
+	return n, err
+}
+
+func (c *helloConn) Write(b []byte) (int, error) {
+	if c.sni != "" {
+		return len(b), nil
+	}
+	return c.Conn.Write(b)
+}
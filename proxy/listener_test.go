@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/denandz/glorp/modifier"
+
+	"github.com/google/martian/v3/mitm"
+)
+
+func TestParseListener(t *testing.T) {
+	lc, err := ParseListener("127.0.0.1:8081,mode=reverse,upstream=https://api.internal:8443,tag=api,proxy=direct,allow=10.0.0.0/8,allow=192.168.1.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ListenerConfig{Addr: "127.0.0.1", Port: 8081, Mode: ModeReverse, Upstream: "https://api.internal:8443", Tag: "api", Proxy: "direct", Allow: []string{"10.0.0.0/8", "192.168.1.5"}}
+	if !reflect.DeepEqual(lc, want) {
+		t.Errorf("got %+v want %+v", lc, want)
+	}
+
+	if lc, _ := ParseListener("8082"); lc.Mode != ModeExplicit || lc.Port != 8082 {
+		t.Errorf("got %+v", lc)
+	}
+
+	for _, s := range []string{"", "0", "8080,mode=socks", "8080,mode=reverse", "8080,cert=ca.crt", "8080,tag", "8080,proxy=ftp://x", "8080,mode=transparent,auth=a:b", "8080,auth=ab", "8080,allow=10.0.0.300"} {
+		if _, err := ParseListener(s); err == nil {
+			t.Errorf("ParseListener(%q) got nil error", s)
+		}
+	}
+}
+
+func TestTransparentPassthrough(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "upstream")
+	}))
+	defer srv.Close()
+
+	// the tunnel's downstream proxy, which sends every CONNECT to the upstream
+	targets := make(chan string, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		targets <- r.Host
+		upstream, err := net.Dial("tcp", srv.Listener.Addr().String())
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		conn, brw, _ := http.NewResponseController(w).Hijack()
+		pipe(brw, conn, upstream)
+		conn.Close()
+		upstream.Close()
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	ca, priv, err := mitm.NewAuthority("glorp test", "glorp", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mc, err := mitm.NewConfig(ca, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifications := make(chan modifier.Notification, 10)
+	logger := modifier.NewLogger(nil, notifications, make(chan modifier.Notification, 10), nil)
+	hl := newTransparentListener(l, mc, NewPassthrough(logger, []string{"passthrough.test"}).modifier(proxyURL))
+	defer hl.Close()
+
+	// a matching SNI reaches the upstream untouched
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{ServerName: "passthrough.test", InsecureSkipVerify: true},
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return net.Dial("tcp", l.Addr().String())
+		},
+	}}
+	res, err := client.Get("https://passthrough.test/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "upstream" || !res.TLS.PeerCertificates[0].Equal(srv.Certificate()) {
+		t.Errorf("TestTransparentPassthrough got %q from %s want upstream from the upstream", body, res.TLS.PeerCertificates[0].Subject)
+	}
+	if target := <-targets; target != "passthrough.test:443" {
+		t.Errorf("TestTransparentPassthrough tunnel target got %s want passthrough.test:443", target)
+	}
+
+	n := <-notifications
+	if e := logger.GetEntry(n.ID); e == nil || e.Source != modifier.SourceTunnel || e.Request.URL != "passthrough.test:443" {
+		t.Errorf("TestTransparentPassthrough got entry %+v want a tunnel to passthrough.test:443", e)
+	}
+
+	// anything else is intercepted
+	conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{ServerName: "other.test", InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if issuer := conn.ConnectionState().PeerCertificates[0].Issuer.CommonName; issuer != "glorp test" {
+		t.Errorf("TestTransparentPassthrough other.test issuer got %q want %q", issuer, "glorp test")
+	}
+}
@@ -0,0 +1,308 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/denandz/glorp/dialer"
+	"github.com/denandz/glorp/modifier"
+
+	"github.com/google/martian/v3"
+)
+
+// Passthrough - host patterns that are tunnelled without interception. CONNECT requests
+// for a matching host are answered by the passthrough itself, which pipes the bytes to
+// the destination untouched and records the tunnel as a connection-level entry
+type Passthrough struct {
+	mu       sync.Mutex
+	patterns []string
+	failures map[string]int
+
+	// AutoAdd - add a host after this many failed client handshakes, 0 disables it
+	AutoAdd int
+
+	logger *modifier.Logger
+}
+
+// passthroughModifier - the passthrough for one listener, tunnels go through that
+// listener's downstream proxy
+type passthroughModifier struct {
+	*Passthrough
+	proxyURL *url.URL
+}
+
+// modifier - the request modifier for a listener using proxyURL, which may be nil
+func (p *Passthrough) modifier(proxyURL *url.URL) *passthroughModifier {
+	return &passthroughModifier{p, proxyURL}
+}
+
+// NewPassthrough - create a passthrough list. Patterns are hostnames, optionally with
+// shell style wildcards such as *.apple.com
+func NewPassthrough(logger *modifier.Logger, patterns []string) *Passthrough {
+	p := &Passthrough{
+		failures: make(map[string]int),
+		logger:   logger,
+	}
+	for _, pattern := range patterns {
+		p.Add(pattern)
+	}
+	return p
+}
+
+// Add - add a host pattern
+func (p *Passthrough) Add(pattern string) {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if pattern == "" {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, v := range p.patterns {
+		if v == pattern {
+			return
+		}
+	}
+	p.patterns = append(p.patterns, pattern)
+}
+
+// Remove - remove a host pattern
+func (p *Passthrough) Remove(pattern string) {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, v := range p.patterns {
+		if v == pattern {
+			p.patterns = append(p.patterns[:i], p.patterns[i+1:]...)
+			return
+		}
+	}
+}
+
+// Patterns - the current host patterns
+func (p *Passthrough) Patterns() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]string(nil), p.patterns...)
+}
+
+// Match - whether host, with or without a port, matches one of the patterns
+func (p *Passthrough) Match(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, pattern := range p.patterns {
+		if ok, _ := path.Match(pattern, host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// HandshakeFailed - count a failed client handshake for req's host, adding the host to
+// the list once it reaches AutoAdd failures
+func (p *Passthrough) HandshakeFailed(req *http.Request) {
+	if p.AutoAdd <= 0 {
+		return
+	}
+
+	host := strings.ToLower(req.URL.Hostname())
+	if host == "" || host == LandingHost {
+		return
+	}
+
+	p.mu.Lock()
+	p.failures[host]++
+	n := p.failures[host]
+	p.mu.Unlock()
+
+	if n == p.AutoAdd {
+		p.Add(host)
+		log.Printf("[+] Passthrough - added %s after %d failed client handshakes\n", host, n)
+	}
+}
+
+// ModifyRequest - take over CONNECT requests for matching hosts. The tunnel runs until
+// both sides are done, martian's connection handling waits for it and then closes the
+// hijacked connection
+func (p *passthroughModifier) ModifyRequest(req *http.Request) error {
+	if req.Method != http.MethodConnect || !p.Match(req.URL.Host) {
+		return nil
+	}
+
+	ctx := martian.NewContext(req)
+	if ctx == nil {
+		return nil
+	}
+
+	conn, brw, err := ctx.Session().Hijack()
+	if err != nil {
+		return err
+	}
+
+	id := ctx.ID()
+	if err := p.logger.RecordTunnel(id, req); err != nil {
+		log.Printf("[!] Passthrough - %s\n", err)
+	}
+
+	upstream, err := p.dial(req)
+	if err != nil {
+		log.Printf("[!] Passthrough - could not connect to %s: %s\n", req.URL.Host, err)
+		res := &http.Response{
+			StatusCode: http.StatusBadGateway,
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     http.Header{"Connection": []string{"close"}},
+		}
+		res.Write(brw)
+		brw.Flush()
+		closeWrite(conn)
+		p.logger.CloseTunnel(id, 0, 0, err)
+		return nil
+	}
+	defer upstream.Close()
+	p.logger.SetRemoteAddr(id, upstream.RemoteAddr().String())
+
+	// martian sets a deadline for reading the next request, tunnels live as long as they need
+	conn.SetDeadline(time.Time{})
+
+	brw.WriteString("HTTP/1.1 200 Connection Established\r\n\r\n")
+	if err := brw.Flush(); err != nil {
+		p.logger.CloseTunnel(id, 0, 0, err)
+		return nil
+	}
+
+	sent, received, err := pipe(brw, conn, upstream)
+	p.logger.CloseTunnel(id, sent, received, err)
+
+	return nil
+}
+
+// tunnel - pipe a transparent TLS connection straight to addr, the host in its SNI. conn
+// replays the ClientHello that was read to find the host. The tunnel is recorded like a
+// CONNECT one, with a request made up from the SNI
+func (p *passthroughModifier) tunnel(conn net.Conn, addr string) {
+	defer conn.Close()
+
+	req := &http.Request{
+		Method:     http.MethodConnect,
+		URL:        &url.URL{Scheme: "https", Host: addr},
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"User-Agent": []string{""}}, // keep Go's out of the record
+		Host:       addr,
+		RemoteAddr: conn.RemoteAddr().String(),
+	}
+
+	id := tunnelID()
+	if err := p.logger.RecordTunnel(id, req); err != nil {
+		log.Printf("[!] Passthrough - %s\n", err)
+	}
+
+	upstream, err := p.dial(req)
+	if err != nil {
+		log.Printf("[!] Passthrough - could not connect to %s: %s\n", addr, err)
+		p.logger.CloseTunnel(id, 0, 0, err)
+		return
+	}
+	defer upstream.Close()
+	p.logger.SetRemoteAddr(id, upstream.RemoteAddr().String())
+
+	sent, received, err := pipe(bufio.NewReadWriter(bufio.NewReader(conn), nil), conn, upstream)
+	p.logger.CloseTunnel(id, sent, received, err)
+}
+
+// tunnelID - an entry ID for a tunnel that didn't come through martian, in the same form
+// as martian's
+func tunnelID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// dial - connect to the CONNECT target the way the routing rules say, through the
+// downstream proxy when no route matches
+func (p *passthroughModifier) dial(req *http.Request) (net.Conn, error) {
+	return dialer.DialRoute(req.Context(), "tcp", req.URL.Host, p.proxyURL)
+}
+
+// pipe - copy both ways until one side is done, returning the byte counts. Anything the
+// client sent that is already sitting in brw goes first. Each direction is half-closed
+// when it finishes, so the client connection is left for martian to close once it sees EOF
+func pipe(brw *bufio.ReadWriter, client, upstream net.Conn) (sent, received int64, err error) {
+	errc := make(chan error, 2)
+
+	go func() {
+		var e error
+		sent, e = io.Copy(upstream, brw.Reader)
+		closeWrite(upstream)
+		errc <- e
+	}()
+
+	go func() {
+		var e error
+		received, e = io.Copy(client, upstream)
+		closeWrite(client)
+		// give the client a moment to close its side before giving up on it
+		client.SetReadDeadline(time.Now().Add(5 * time.Second))
+		errc <- e
+	}()
+
+	for range 2 {
+		e := <-errc
+		var ne net.Error
+		if e == nil || err != nil || errors.Is(e, net.ErrClosed) || (errors.As(e, &ne) && ne.Timeout()) {
+			continue
+		}
+		err = e
+	}
+
+	return sent, received, err
+}
+
+// closeWrite - half-close conn when it supports it, otherwise close it
+func closeWrite(conn net.Conn) {
+	if c, ok := conn.(interface{ CloseWrite() error }); ok {
+		c.CloseWrite()
+		return
+	}
+	conn.Close()
+}
+
+// bufferedConn - a net.Conn that reads through a bufio.Reader, so bytes buffered while
+// sniffing the connection aren't lost
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// CloseWrite - half-close the underlying connection
+func (c *bufferedConn) CloseWrite() error {
+	closeWrite(c.Conn)
+	return nil
+}
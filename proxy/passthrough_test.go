@@ -0,0 +1,25 @@
+package proxy
+
+import "testing"
+
+func TestPassthroughMatch(t *testing.T) {
+	p := NewPassthrough(nil, []string{"*.Apple.com", " pinned.example.com "})
+
+	tests := map[string]bool{
+		"gs.apple.com:443":          true,
+		"a.b.apple.com":             true,
+		"apple.com:443":             false,
+		"pinned.example.com:8443":   true,
+		"notpinned.example.com:443": false,
+	}
+	for host, want := range tests {
+		if got := p.Match(host); got != want {
+			t.Errorf("Match(%q) got %v want %v", host, got, want)
+		}
+	}
+
+	p.Remove("pinned.example.com")
+	if p.Match("pinned.example.com:443") {
+		t.Errorf("Match after Remove got true want false")
+	}
+}
@@ -3,6 +3,7 @@ package proxy
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"fmt"
 	"log"
 	"net"
 	"net/http"
@@ -10,6 +11,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/denandz/glorp/dialer"
 	"github.com/denandz/glorp/modifier"
 
 	"github.com/google/martian/v3"
@@ -23,8 +25,20 @@ type Config struct {
 	Addr  string // ip address to listen on, default 0.0.0.0
 	Proxy string // downstream proxy to use, optional.
 
-	Cert string // CA certificate
-	Key  string // key
+	Cert  string // CA certificate
+	Key   string // key
+	CADir string // where the generated CA is kept when Cert and Key aren't set, defaults to DefaultCADir
+
+	Transparent bool // also accept clients that aren't proxy aware, sniffing TLS and using SNI and Host headers
+
+	Allow []string // IP addresses and CIDR ranges allowed to connect, empty allows everyone
+	Auth  string   // user:password required from clients of explicit and SOCKS5 listeners, optional
+
+	Passthrough     []string // host patterns tunnelled without interception
+	AutoPassthrough int      // add hosts to the passthrough list after this many failed client handshakes, 0 disables
+
+	// Listeners to start. When empty, a single listener is started from Port, Addr and Transparent
+	Listeners []ListenerConfig
 }
 
 func (config *Config) checkConfig() {
@@ -36,93 +50,224 @@ func (config *Config) checkConfig() {
 		config.Addr = "0.0.0.0"
 	}
 
+	if len(config.Listeners) == 0 {
+		lc := ListenerConfig{Port: config.Port, Mode: ModeExplicit}
+		if config.Transparent {
+			lc.Mode = ModeTransparent
+		}
+		config.Listeners = []ListenerConfig{lc}
+	}
 }
 
-// StartProxy - Starts the martian proxy and sets up the modifier. Nil config will set some reasonable defaults
-func StartProxy(logger *modifier.Logger, config *Config) *martian.Proxy {
+// StartProxy - Starts a martian proxy for each listener and sets up the modifiers. Nil config will set some reasonable defaults
+func StartProxy(logger *modifier.Logger, config *Config) []*martian.Proxy {
 	if config == nil {
 		config = new(Config)
 	}
 
 	config.checkConfig()
 
-	p := martian.NewProxy()
-
-	tr := &http.Transport{
-		Dial: (&net.Dialer{
-			Timeout:   30 * time.Second,
-			KeepAlive: 30 * time.Second,
-		}).Dial,
-		TLSHandshakeTimeout:   10 * time.Second,
-		ExpectContinueTimeout: time.Second,
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
-		DisableCompression: true,
-	}
-	p.SetRoundTripper(tr)
-
-	if config.Proxy != "" {
-		proxyURL, err := url.Parse(config.Proxy)
-		if err != nil {
-			log.Printf("martian: error parsing upstream proxy URL: %v, skipping proxy\n", err)
-		} else {
-			p.SetDownstreamProxy(proxyURL)
-		}
-	}
-
 	var x509c *x509.Certificate
 	var priv interface{}
 	var err error
 
 	if config.Cert != "" && config.Key != "" {
-		tlsc, err := tls.LoadX509KeyPair(config.Cert, config.Key)
+		x509c, priv, err = LoadCA(config.Cert, config.Key)
 		if err != nil {
 			log.Fatal(err)
 		}
-		priv = tlsc.PrivateKey
+	} else {
+		dir := config.CADir
+		if dir == "" {
+			dir, err = DefaultCADir()
+		}
+		if err == nil {
+			x509c, priv, err = LoadOrCreateCA(dir)
+		}
 
-		x509c, err = x509.ParseCertificate(tlsc.Certificate[0])
 		if err != nil {
-			log.Fatal(err)
+			// fall back to a throwaway CA so the proxy still starts
+			log.Printf("[!] Could not load or save the CA, using a temporary one: %s\n", err)
+			x509c, priv, err = mitm.NewAuthority("martian.proxy", "Martian Authority", 30*24*time.Hour)
+			if err != nil {
+				log.Fatal(err)
+			}
 		}
-	} else {
-		x509c, priv, err = mitm.NewAuthority("martian.proxy", "Martian Authority", 30*24*time.Hour)
+	}
+
+	passthrough := NewPassthrough(logger, config.Passthrough)
+	passthrough.AutoAdd = config.AutoPassthrough
+
+	var proxies []*martian.Proxy
+	for _, lc := range config.Listeners {
+		p, err := startListener(logger, config, lc, passthrough, x509c, priv)
 		if err != nil {
 			log.Fatal(err)
 		}
+		proxies = append(proxies, p)
 	}
 
-	if x509c != nil && priv != nil {
-		mc, err := mitm.NewConfig(x509c, priv)
+	return proxies
+}
+
+// startListener - start a martian proxy for one listener, using the listener's CA and
+// downstream proxy if it has its own
+func startListener(logger *modifier.Logger, config *Config, lc ListenerConfig, passthrough *Passthrough, x509c *x509.Certificate, priv interface{}) (*martian.Proxy, error) {
+	if lc.Addr == "" {
+		lc.Addr = config.Addr
+	}
+
+	if lc.Proxy == "" {
+		lc.Proxy = config.Proxy
+	}
+
+	if lc.Allow == nil {
+		lc.Allow = config.Allow
+	}
+
+	if lc.Auth == "" {
+		lc.Auth = config.Auth
+	}
+
+	var proxyURL *url.URL
+	if lc.Proxy != "" && lc.Proxy != "direct" {
+		u, err := url.Parse(lc.Proxy)
 		if err != nil {
-			log.Fatal(err)
+			log.Printf("martian: error parsing upstream proxy URL: %v, skipping proxy\n", err)
+		} else {
+			proxyURL = u
 		}
+	}
 
-		mc.SkipTLSVerify(true)
-		mc.SetHandshakeErrorCallback(func(req *http.Request, err error) {
-			log.Printf("[!] TLS client handshake error for domain %s: %v\n", req.Host, err)
-		})
+	if lc.Cert != "" && lc.Key != "" {
+		var err error
+		if x509c, priv, err = LoadCA(lc.Cert, lc.Key); err != nil {
+			return nil, err
+		}
+	}
 
-		p.SetMITM(mc)
+	mc, err := mitm.NewConfig(x509c, priv)
+	if err != nil {
+		return nil, err
 	}
 
+	mc.SkipTLSVerify(true)
+	mc.SetHandshakeErrorCallback(func(req *http.Request, err error) {
+		log.Printf("[!] TLS client handshake error for domain %s: %v\n", req.Host, err)
+		passthrough.HandshakeFailed(req)
+	})
+
+	p := newMartian(proxyURL)
+
 	topg := fifo.NewGroup()
+	if lc.Tag != "" {
+		topg.AddRequestModifier(tagModifier(lc.Tag))
+	}
+
+	// map rules run ahead of the logger, so it records what the client actually got
+	rules := new(modifier.RuleModifier)
+
+	var upstream *url.URL
+	if lc.Mode == ModeReverse {
+		if upstream, err = lc.upstreamURL(); err != nil {
+			return nil, err
+		}
 
-	topg.AddRequestModifier(logger)
-	topg.AddResponseModifier(logger)
+		topg.AddRequestModifier(&reverseModifier{upstream: upstream})
+		topg.AddRequestModifier(rules)
+		topg.AddResponseModifier(rules)
+		topg.AddRequestModifier(logger)
+		topg.AddResponseModifier(logger)
+	} else {
+		p.SetMITM(mc)
 
-	p.SetRequestModifier(topg)
-	p.SetResponseModifier(topg)
+		topg.AddRequestModifier(passthrough.modifier(proxyURL))
+		topg.AddRequestModifier(rules)
+		topg.AddResponseModifier(rules)
 
-	l, err := net.Listen("tcp", config.Addr+":"+strconv.FormatInt(int64(config.Port), 10))
+		landing := &landingPage{cert: x509c, next: logger}
+		topg.AddRequestModifier(landing)
+		topg.AddResponseModifier(landing)
+	}
+
+	if lc.Auth != "" && lc.Mode == ModeExplicit {
+		auth := &proxyAuth{creds: lc.Auth, next: topg}
+		p.SetRequestModifier(auth)
+		p.SetResponseModifier(auth)
+	} else {
+		p.SetRequestModifier(topg)
+		p.SetResponseModifier(topg)
+	}
+
+	allow, err := ParseAllow(lc.Allow)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	log.Printf("martian: starting proxy on %s\n", l.Addr().String())
+	l, err := net.Listen("tcp", lc.Addr+":"+strconv.FormatInt(int64(lc.Port), 10))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(allow) > 0 {
+		l = &allowListener{Listener: l, allow: allow}
+	}
+
+	if lc.Auth != "" && (lc.Mode == ModeTransparent || lc.Mode == ModeReverse) {
+		log.Printf("[!] Proxy authentication doesn't apply to the %s listener on %s, use an allow list\n", lc.Mode, l.Addr())
+	}
+
+	desc := ""
+	if lc.Tag != "" {
+		desc = fmt.Sprintf(" (tag %s)", lc.Tag)
+	}
+
+	switch lc.Mode {
+	case ModeTransparent:
+		l = newTransparentListener(l, mc, passthrough.modifier(proxyURL))
+		log.Printf("martian: starting transparent proxy on %s%s\n", l.Addr().String(), desc)
+	case ModeSOCKS5:
+		l = newSOCKSListener(l, lc.Auth)
+		log.Printf("martian: starting SOCKS5 proxy on %s%s\n", l.Addr().String(), desc)
+	case ModeReverse:
+		l = newReverseListener(l, mc, lc.certName(upstream))
+		log.Printf("martian: starting reverse proxy on %s for %s%s\n", l.Addr().String(), upstream, desc)
+	default:
+		log.Printf("martian: starting proxy on %s%s\n", l.Addr().String(), desc)
+	}
 
 	go p.Serve(l)
 
+	return p, nil
+}
+
+// newMartian - a martian proxy with its own transport, as martian configures the
+// transport it's given for its downstream proxy
+func newMartian(proxyURL *url.URL) *martian.Proxy {
+	p := martian.NewProxy()
+
+	tr := &http.Transport{
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true,
+		},
+		DisableCompression: true,
+	}
+	p.SetRoundTripper(tr)
+	// used for the transport and CONNECT requests, so hostname overrides apply to both
+	p.SetDial(dialer.Dial)
+	// the transport prefers DialContext, which passes the request's trace on for DNS and connect timings
+	tr.DialContext = dialer.DialContext
+
+	if proxyURL != nil {
+		p.SetDownstreamProxy(proxyURL)
+	}
+
+	// routing rules pick the upstream proxy per request, falling back to the listener's
+	tr.Proxy = func(req *http.Request) (*url.URL, error) {
+		return dialer.Routing.Proxy(req.Context(), req.URL.Host, proxyURL)
+	}
+
 	return p
 }
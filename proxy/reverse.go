@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/google/martian/v3/mitm"
+)
+
+// ParseReverse - parse a reverse listener in the port=upstream[=name] form used by the
+// -reverse flag
+func ParseReverse(s string) (ListenerConfig, error) {
+	lc := ListenerConfig{Mode: ModeReverse}
+
+	parts := strings.Split(s, "=")
+	if len(parts) != 2 && len(parts) != 3 {
+		return lc, errors.New("expected port=upstream or port=upstream=name")
+	}
+
+	p, err := strconv.ParseUint(parts[0], 10, 16)
+	if err != nil || p == 0 {
+		return lc, errors.New("bad port " + parts[0])
+	}
+	lc.Port = uint(p)
+	lc.Upstream = parts[1]
+	if len(parts) == 3 {
+		lc.Name = parts[2]
+	}
+
+	if _, err := lc.upstreamURL(); err != nil {
+		return lc, err
+	}
+
+	return lc, nil
+}
+
+// reverseModifier - point every request at the upstream, ahead of the logger so the
+// history shows where requests actually went
+type reverseModifier struct {
+	upstream *url.URL
+}
+
+// ModifyRequest - rewrite the request's scheme, host and Host header, any path on the
+// upstream is prefixed to the request path
+func (r *reverseModifier) ModifyRequest(req *http.Request) error {
+	req.URL.Scheme = r.upstream.Scheme
+	req.URL.Host = r.upstream.Host
+	req.Host = r.upstream.Host
+
+	if prefix := strings.TrimSuffix(r.upstream.Path, "/"); prefix != "" {
+		req.URL.Path = prefix + req.URL.Path
+		if req.URL.RawPath != "" {
+			req.URL.RawPath = strings.TrimSuffix(r.upstream.EscapedPath(), "/") + req.URL.RawPath
+		}
+	}
+
+	return nil
+}
+
+// newReverseListener - a listener for ordinary HTTP and HTTPS clients, HTTPS clients
+// always get a certificate for name whatever SNI they send
+func newReverseListener(l net.Listener, mc *mitm.Config, name string) *handshakeListener {
+	return newHandshakeListener(l, func(conn net.Conn) net.Conn {
+		cfg := mc.TLSForHost(name)
+		getCertificate := cfg.GetCertificate
+		cfg.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			h := *hello
+			h.ServerName = name
+			return getCertificate(&h)
+		}
+		return sniffTLS(conn, cfg, nil)
+	})
+}
@@ -0,0 +1,32 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParseReverse(t *testing.T) {
+	rc, err := ParseReverse("8443=https://api.internal:8443/v1=api.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rc.Port != 8443 || rc.Upstream != "https://api.internal:8443/v1" || rc.Name != "api.example.com" {
+		t.Errorf("got %+v", rc)
+	}
+
+	for _, s := range []string{"8443", "x=https://a", "8443=ftp://a", "8443=api.internal:8443"} {
+		if _, err := ParseReverse(s); err == nil {
+			t.Errorf("ParseReverse(%q) got nil error", s)
+		}
+	}
+
+	u, _ := rc.upstreamURL()
+	req, _ := http.NewRequest("GET", "http://localhost:8443/users?id=1", nil)
+	(&reverseModifier{upstream: u}).ModifyRequest(req)
+	if got, want := req.URL.String(), "https://api.internal:8443/v1/users?id=1"; got != want {
+		t.Errorf("got %v want %v", got, want)
+	}
+	if req.Host != "api.internal:8443" {
+		t.Errorf("got %v want %v", req.Host, "api.internal:8443")
+	}
+}
@@ -0,0 +1,229 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SOCKS5 constants, RFC 1928 and RFC 1929
+const (
+	socksVersion     = 5
+	socksAuthVersion = 1
+
+	socksNoAuth       = 0
+	socksUserPass     = 2
+	socksNoAcceptable = 0xff
+
+	socksConnect = 1
+
+	socksIPv4   = 1
+	socksDomain = 3
+	socksIPv6   = 4
+
+	socksSucceeded           = 0
+	socksCommandNotSupported = 7
+	socksAddressNotSupported = 8
+)
+
+// newSOCKSListener - a SOCKS5 listener. Once a client asks to CONNECT, the stream is
+// handed to martian as if the client had sent an HTTP CONNECT for the same destination,
+// so the passthrough list, TLS interception and logging all work as they do for the
+// HTTP proxy. auth is user:password, empty to not require authentication
+func newSOCKSListener(l net.Listener, auth string) *handshakeListener {
+	return newHandshakeListener(l, func(conn net.Conn) net.Conn {
+		conn.SetDeadline(time.Now().Add(30 * time.Second))
+		br := bufio.NewReader(conn)
+
+		dest, err := socksHandshake(br, conn, auth)
+		if err != nil {
+			log.Printf("[!] SOCKS5 handshake with %s: %s\n", conn.RemoteAddr(), err)
+			conn.Close()
+			return nil
+		}
+		conn.SetDeadline(time.Time{})
+
+		connect := "CONNECT " + dest + " HTTP/1.1\r\nHost: " + dest + "\r\n\r\n"
+		return &socksConn{
+			Conn: conn,
+			r:    io.MultiReader(strings.NewReader(connect), br),
+		}
+	})
+}
+
+// socksHandshake - negotiate authentication and read the CONNECT request, returning the
+// destination as host:port
+func socksHandshake(br *bufio.Reader, w io.Writer, auth string) (string, error) {
+	// version and methods
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(br, head); err != nil {
+		return "", err
+	}
+	if head[0] != socksVersion {
+		return "", errors.New("unsupported SOCKS version " + strconv.Itoa(int(head[0])))
+	}
+	methods := make([]byte, head[1])
+	if _, err := io.ReadFull(br, methods); err != nil {
+		return "", err
+	}
+
+	method := byte(socksNoAuth)
+	if auth != "" {
+		method = socksUserPass
+	}
+	if bytes.IndexByte(methods, method) == -1 {
+		w.Write([]byte{socksVersion, socksNoAcceptable})
+		return "", errors.New("no acceptable authentication method")
+	}
+	if _, err := w.Write([]byte{socksVersion, method}); err != nil {
+		return "", err
+	}
+
+	if method == socksUserPass {
+		if err := socksAuth(br, w, auth); err != nil {
+			return "", err
+		}
+	}
+
+	// the request
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(br, req); err != nil {
+		return "", err
+	}
+	if req[0] != socksVersion {
+		return "", errors.New("unsupported SOCKS version " + strconv.Itoa(int(req[0])))
+	}
+
+	var host string
+	switch req[3] {
+	case socksIPv4, socksIPv6:
+		ip := make(net.IP, 4)
+		if req[3] == socksIPv6 {
+			ip = make(net.IP, 16)
+		}
+		if _, err := io.ReadFull(br, ip); err != nil {
+			return "", err
+		}
+		host = ip.String()
+	case socksDomain:
+		n, err := br.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		name := make([]byte, n)
+		if _, err := io.ReadFull(br, name); err != nil {
+			return "", err
+		}
+		host = string(name)
+	default:
+		socksReply(w, socksAddressNotSupported)
+		return "", errors.New("unsupported address type " + strconv.Itoa(int(req[3])))
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(br, port); err != nil {
+		return "", err
+	}
+
+	if req[1] != socksConnect {
+		socksReply(w, socksCommandNotSupported)
+		return "", errors.New("unsupported command " + strconv.Itoa(int(req[1])))
+	}
+
+	if err := socksReply(w, socksSucceeded); err != nil {
+		return "", err
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(int(port[0])<<8|int(port[1]))), nil
+}
+
+// socksAuth - username and password authentication
+func socksAuth(br *bufio.Reader, w io.Writer, auth string) error {
+	ver, err := br.ReadByte()
+	if err != nil {
+		return err
+	}
+	if ver != socksAuthVersion {
+		return errors.New("unsupported authentication version " + strconv.Itoa(int(ver)))
+	}
+
+	var fields [2][]byte
+	for i := range fields {
+		n, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+		fields[i] = make([]byte, n)
+		if _, err := io.ReadFull(br, fields[i]); err != nil {
+			return err
+		}
+	}
+
+	got := string(fields[0]) + ":" + string(fields[1])
+	if subtle.ConstantTimeCompare([]byte(got), []byte(auth)) != 1 {
+		w.Write([]byte{socksAuthVersion, 1})
+		return errors.New("bad username or password for " + string(fields[0]))
+	}
+
+	_, err = w.Write([]byte{socksAuthVersion, 0})
+	return err
+}
+
+// socksReply - send a reply to the request. The bound address isn't meaningful here, so
+// it's always 0.0.0.0:0
+func socksReply(w io.Writer, rep byte) error {
+	_, err := w.Write([]byte{socksVersion, rep, 0, socksIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+// socksConn - a SOCKS client's stream, dressed up as an HTTP CONNECT. Reads start with
+// the CONNECT request and the response martian writes to it is dropped, the client
+// has already had its SOCKS reply
+type socksConn struct {
+	net.Conn
+	r io.Reader
+
+	replied bool
+	head    []byte
+}
+
+func (c *socksConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func (c *socksConn) Write(b []byte) (int, error) {
+	if c.replied {
+		return c.Conn.Write(b)
+	}
+
+	c.head = append(c.head, b...)
+	i := bytes.Index(c.head, []byte("\r\n\r\n"))
+	if i == -1 {
+		return len(b), nil
+	}
+
+	c.replied = true
+	if rest := c.head[i+4:]; len(rest) > 0 {
+		if _, err := c.Conn.Write(rest); err != nil {
+			return 0, err
+		}
+	}
+	c.head = nil
+
+	return len(b), nil
+}
+
+// CloseWrite - half-close the client connection, for passthrough tunnels
+func (c *socksConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return c.Conn.Close()
+}
@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"testing"
+)
+
+// bufConn - a net.Conn that only supports writes, into a buffer
+type bufConn struct {
+	net.Conn
+	w *bytes.Buffer
+}
+
+func (c *bufConn) Write(b []byte) (int, error) {
+	return c.w.Write(b)
+}
+
+func TestSOCKSHandshake(t *testing.T) {
+	in := []byte{5, 1, 2} // version 5, one method, username/password
+	in = append(in, 1, 3, 'b', 'o', 'b', 6, 's', 'e', 'c', 'r', 'e', 't')
+	in = append(in, 5, 1, 0, 3, 11)
+	in = append(in, "example.com"...)
+	in = append(in, 0x01, 0xbb)
+
+	var out bytes.Buffer
+	dest, err := socksHandshake(bufio.NewReader(bytes.NewReader(in)), &out, "bob:secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dest != "example.com:443" {
+		t.Errorf("got %v want %v", dest, "example.com:443")
+	}
+	if want := []byte{5, 2, 1, 0, 5, 0, 0, 1, 0, 0, 0, 0, 0, 0}; !bytes.Equal(out.Bytes(), want) {
+		t.Errorf("got %v want %v", out.Bytes(), want)
+	}
+
+	out.Reset()
+	in = []byte{5, 1, 0, 5, 1, 0, 4, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 80}
+	if _, err := socksHandshake(bufio.NewReader(bytes.NewReader(in)), &out, "bob:secret"); err == nil {
+		t.Errorf("got nil error for a client without username/password auth")
+	}
+
+	dest, err = socksHandshake(bufio.NewReader(bytes.NewReader(in)), &out, "")
+	if err != nil || dest != "[::1]:80" {
+		t.Errorf("got %v, %v want [::1]:80", dest, err)
+	}
+}
+
+func TestSOCKSConnWrite(t *testing.T) {
+	var buf bytes.Buffer
+	c := &socksConn{Conn: &bufConn{w: &buf}}
+	c.Write([]byte("HTTP/1.1 200 OK\r\nContent-"))
+	c.Write([]byte("Length: 0\r\n\r\n\x16\x03"))
+	c.Write([]byte("\x01"))
+	if got := buf.String(); got != "\x16\x03\x01" {
+		t.Errorf("got %q want %q", got, "\x16\x03\x01")
+	}
+}
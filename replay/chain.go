@@ -0,0 +1,130 @@
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Chain - an ordered list of replay items that are sent one after another. Values
+// pulled out of a step's response can be substituted into later requests
+// using the {{name}} syntax
+type Chain struct {
+	Name  string      // the name of the chain
+	Steps []ChainStep // the steps, in the order they are sent
+}
+
+// ChainStep - a single step in a chain, referencing a replay item by ID
+type ChainStep struct {
+	ID      string        // the replay item ID to send
+	Extract []ExtractRule // rules to run against the response of this step
+}
+
+// ExtractRule - pulls a value out of a raw response with a regex. The first capture
+// group is stored under Name, or the whole match if the pattern has no groups
+type ExtractRule struct {
+	Name    string
+	Pattern string
+}
+
+var variableRegex = regexp.MustCompile(`{{([A-Za-z0-9_\-]+)}}`)
+
+// ParseChain - build a chain from its text definition. Each line is either
+// "step <replay id>" or "extract <name> <regex>", extract lines apply to the
+// step above them. Blank lines and lines starting with # are ignored
+func ParseChain(name string, definition string) (*Chain, error) {
+	c := &Chain{Name: name}
+
+	scanner := bufio.NewScanner(strings.NewReader(definition))
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		keyword, rest, _ := strings.Cut(line, " ")
+		rest = strings.TrimSpace(rest)
+
+		switch keyword {
+		case "step":
+			if rest == "" {
+				return nil, fmt.Errorf("line %d: step needs a replay ID", n)
+			}
+			c.Steps = append(c.Steps, ChainStep{ID: rest})
+
+		case "extract":
+			if len(c.Steps) == 0 {
+				return nil, fmt.Errorf("line %d: extract before the first step", n)
+			}
+			varName, pattern, _ := strings.Cut(rest, " ")
+			pattern = strings.TrimSpace(pattern)
+			if varName == "" || pattern == "" {
+				return nil, fmt.Errorf("line %d: extract needs a name and a regex", n)
+			}
+			if _, err := regexp.Compile(pattern); err != nil {
+				return nil, fmt.Errorf("line %d: %s", n, err)
+			}
+			step := &c.Steps[len(c.Steps)-1]
+			step.Extract = append(step.Extract, ExtractRule{Name: varName, Pattern: pattern})
+
+		default:
+			return nil, fmt.Errorf("line %d: unknown keyword %q", n, keyword)
+		}
+	}
+
+	if len(c.Steps) == 0 {
+		return nil, fmt.Errorf("chain has no steps")
+	}
+
+	return c, nil
+}
+
+// String - return the text definition of the chain, the inverse of ParseChain
+func (c *Chain) String() string {
+	var sb strings.Builder
+	for _, step := range c.Steps {
+		fmt.Fprintf(&sb, "step %s\n", step.ID)
+		for _, rule := range step.Extract {
+			fmt.Fprintf(&sb, "extract %s %s\n", rule.Name, rule.Pattern)
+		}
+	}
+	return sb.String()
+}
+
+// Apply - run the rule against a raw response, returning the extracted value
+func (rule ExtractRule) Apply(response []byte) (string, bool) {
+	re, err := regexp.Compile(rule.Pattern)
+	if err != nil {
+		return "", false
+	}
+
+	match := re.FindSubmatch(response)
+	if match == nil {
+		return "", false
+	}
+	if len(match) > 1 {
+		return string(match[1]), true
+	}
+	return string(match[0]), true
+}
+
+// Substitute - replace {{name}} placeholders in data with the matching variable.
+// Placeholders without a value are left untouched. The returned slice never shares
+// memory with data
+func Substitute(data []byte, vars map[string]string) []byte {
+	if !bytes.Contains(data, []byte("{{")) {
+		return bytes.Clone(data)
+	}
+
+	return variableRegex.ReplaceAllFunc(data, func(m []byte) []byte {
+		name := variableRegex.FindSubmatch(m)[1]
+		if v, ok := vars[string(name)]; ok {
+			return []byte(v)
+		}
+		return m
+	})
+}
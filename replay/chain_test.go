@@ -0,0 +1,54 @@
+package replay
+
+import (
+	"testing"
+)
+
+func TestParseChain(t *testing.T) {
+	definition := `
+# log in, grab the CSRF token, then submit the form
+step login
+extract session Set-Cookie: session=([^;]+)
+step csrf
+extract token name="csrf" value="([^"]+)"
+step submit
+`
+	c, err := ParseChain("form", definition)
+	if err != nil {
+		t.Fatalf("TestParseChain ParseChain: %s", err)
+	}
+
+	if l := len(c.Steps); l != 3 {
+		t.Fatalf("TestParseChain unexpected number of steps: got %v want %v", l, 3)
+	}
+
+	if l := len(c.Steps[1].Extract); l != 1 {
+		t.Errorf("TestParseChain unexpected number of extract rules: got %v want %v", l, 1)
+	}
+
+	again, err := ParseChain("form", c.String())
+	if err != nil || len(again.Steps) != 3 || again.Steps[0].Extract[0].Pattern != c.Steps[0].Extract[0].Pattern {
+		t.Errorf("TestParseChain String did not round trip: %v", err)
+	}
+
+	if _, err := ParseChain("bad", "extract token (.*)"); err == nil {
+		t.Errorf("TestParseChain extract before step: got %v want an error", err)
+	}
+}
+
+func TestExtractSubstitute(t *testing.T) {
+	response := []byte("HTTP/1.1 200 OK\r\nSet-Cookie: session=abc123; HttpOnly\r\n\r\n")
+	rule := ExtractRule{Name: "session", Pattern: `session=([^;]+)`}
+
+	v, ok := rule.Apply(response)
+	if !ok || v != "abc123" {
+		t.Fatalf("TestExtractSubstitute Apply: got %v want %v", v, "abc123")
+	}
+
+	request := []byte("GET / HTTP/1.1\r\nCookie: session={{session}}; other={{missing}}\r\n\r\n")
+	got := string(Substitute(request, map[string]string{"session": v}))
+	want := "GET / HTTP/1.1\r\nCookie: session=abc123; other={{missing}}\r\n\r\n"
+	if got != want {
+		t.Errorf("TestExtractSubstitute Substitute: got %q want %q", got, want)
+	}
+}
@@ -0,0 +1,499 @@
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// curl options that take a value, options not listed here are treated as switches.
+// Values of options that aren't handled below are skipped
+var curlValueOptions = map[string]bool{
+	"-X": true, "--request": true,
+	"-H": true, "--header": true,
+	"-d": true, "--data": true, "--data-ascii": true, "--data-binary": true, "--data-raw": true, "--data-urlencode": true, "--json": true,
+	"-b": true, "--cookie": true,
+	"-u": true, "--user": true,
+	"-A": true, "--user-agent": true,
+	"-e": true, "--referer": true, "--url": true,
+	"-o": true, "--output": true, "-w": true, "--write-out": true, "-x": true, "--proxy": true,
+	"-m": true, "--max-time": true, "--connect-timeout": true, "--resolve": true, "--connect-to": true,
+	"-E": true, "--cert": true, "--key": true, "--cacert": true, "-c": true, "--cookie-jar": true,
+	"-F": true, "--form": true, "-T": true, "--upload-file": true, "-r": true, "--range": true,
+}
+
+// FromCurl - build a replay request from a curl command line. The common request
+// options are understood, anything else is ignored
+func FromCurl(cmd string) (*Request, error) {
+	args, err := shellSplit(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) > 0 && (args[0] == "curl" || strings.HasSuffix(args[0], "/curl") || strings.HasSuffix(args[0], "curl.exe")) {
+		args = args[1:]
+	}
+
+	var (
+		method, target, cookie, version string
+		headers                         [][2]string
+		removed                         = make(map[string]bool)
+		data                            []string
+		get, head, h2                   bool
+	)
+
+	setHeader := func(name, value string) {
+		for i, h := range headers {
+			if strings.EqualFold(h[0], name) {
+				headers[i][1] = value
+				return
+			}
+		}
+		headers = append(headers, [2]string{name, value})
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		var opt, value string
+		hasValue := false
+
+		switch {
+		case strings.HasPrefix(arg, "--"):
+			opt = arg
+			if name, v, found := strings.Cut(arg, "="); found && curlValueOptions[name] {
+				opt, value, hasValue = name, v, true
+			}
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			// short switches can be grouped, eg -sSk, and a value can follow directly, eg -XPOST
+			for j := 1; j < len(arg); j++ {
+				opt = "-" + string(arg[j])
+				if curlValueOptions[opt] {
+					if j+1 < len(arg) {
+						value, hasValue = arg[j+1:], true
+					}
+					break
+				}
+				switch opt {
+				case "-G":
+					get = true
+				case "-I":
+					head = true
+				}
+			}
+		default:
+			if target == "" {
+				target = arg
+			}
+			continue
+		}
+
+		if curlValueOptions[opt] && !hasValue {
+			i++
+			if i >= len(args) {
+				return nil, fmt.Errorf("missing value for %s", opt)
+			}
+			value = args[i]
+		}
+
+		switch opt {
+		case "-X", "--request":
+			method = value
+		case "-H", "--header":
+			name, v, found := strings.Cut(value, ":")
+			if !found {
+				// "Name;" sends an empty header
+				if name, found = strings.CutSuffix(value, ";"); found {
+					headers = append(headers, [2]string{name, ""})
+				}
+				continue
+			}
+			if v = strings.TrimLeft(v, " "); v == "" {
+				// "Name:" removes a header curl would otherwise send
+				removed[strings.ToLower(name)] = true
+				continue
+			}
+			headers = append(headers, [2]string{name, v})
+		case "-d", "--data", "--data-ascii", "--data-binary", "--data-raw", "--data-urlencode", "--json":
+			d, err := curlData(opt, value)
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, d)
+			if opt == "--json" {
+				setHeader("Content-Type", "application/json")
+				setHeader("Accept", "application/json")
+			}
+		case "-b", "--cookie":
+			// a value without an = is a cookie file, which we don't read
+			if strings.Contains(value, "=") {
+				if cookie != "" {
+					cookie += "; "
+				}
+				cookie += value
+			}
+		case "-u", "--user":
+			setHeader("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(value)))
+		case "-A", "--user-agent":
+			setHeader("User-Agent", value)
+		case "-e", "--referer":
+			setHeader("Referer", value)
+		case "--url":
+			target = value
+		case "--compressed":
+			setHeader("Accept-Encoding", "deflate, gzip, br, zstd")
+		case "--get":
+			get = true
+		case "--head":
+			head = true
+		case "--http1.0":
+			version = "HTTP/1.0"
+		case "--http2", "--http2-prior-knowledge":
+			h2 = true
+		}
+	}
+
+	if target == "" {
+		return nil, fmt.Errorf("no URL in curl command")
+	}
+	if !strings.Contains(target, "://") {
+		target = "http://" + target
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+
+	body := strings.Join(data, "&")
+	if get && body != "" {
+		if u.RawQuery != "" {
+			u.RawQuery += "&"
+		}
+		u.RawQuery += body
+		body = ""
+	}
+
+	switch {
+	case method != "":
+	case head:
+		method = http.MethodHead
+	case body != "":
+		method = http.MethodPost
+	default:
+		method = http.MethodGet
+	}
+
+	if version == "" {
+		version = "HTTP/1.1"
+	}
+
+	r := &Request{ID: "curl"}
+	if err := r.setDestination(u); err != nil {
+		return nil, err
+	}
+
+	// curl's own headers go first, a -H with the same name replaces them
+	all := [][2]string{{"Host", u.Host}, {"Accept", "*/*"}}
+	if body != "" {
+		all = append(all, [2]string{"Content-Type", "application/x-www-form-urlencoded"})
+	}
+	for _, h := range headers {
+		replaced := false
+		for i := range all {
+			if strings.EqualFold(all[i][0], h[0]) {
+				all[i] = h
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			all = append(all, h)
+		}
+	}
+	if cookie != "" {
+		all = append(all, [2]string{"Cookie", cookie})
+	}
+	if body != "" {
+		all = append(all, [2]string{"Content-Length", strconv.Itoa(len(body))})
+	}
+	all = append(all, [2]string{"Connection", "close"})
+
+	var raw bytes.Buffer
+	fmt.Fprintf(&raw, "%s %s %s\r\n", method, u.RequestURI(), version)
+	for _, h := range all {
+		if !removed[strings.ToLower(h[0])] {
+			fmt.Fprintf(&raw, "%s: %s\r\n", h[0], h[1])
+		}
+	}
+	raw.WriteString("\r\n")
+	raw.WriteString(body)
+
+	r.RawRequest = raw.Bytes()
+	if h2 {
+		r.Protocol = ProtoH2
+		r.RawRequest = ToH2Request(r.RawRequest, r.TLS)
+	}
+
+	return r, nil
+}
+
+// curlData - the body data for a curl data option, reading @file references
+func curlData(opt, value string) (string, error) {
+	switch opt {
+	case "--data-raw":
+		return value, nil
+	case "--data-urlencode":
+		name, v, found := strings.Cut(value, "=")
+		if !found {
+			return url.QueryEscape(value), nil
+		}
+		if name == "" {
+			return url.QueryEscape(v), nil
+		}
+		return name + "=" + url.QueryEscape(v), nil
+	}
+
+	file, ok := strings.CutPrefix(value, "@")
+	if !ok {
+		return value, nil
+	}
+
+	d, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	if opt == "--data-binary" {
+		return string(d), nil
+	}
+	// -d strips carriage returns and newlines from files
+	return strings.NewReplacer("\r", "", "\n", "").Replace(string(d)), nil
+}
+
+// FromRaw - build a replay request from a raw HTTP request, such as a request saved
+// to a file. The destination comes from an absolute request target, the :scheme and
+// :authority of an HTTP/2 request, or the Host header. Without an explicit scheme
+// port 80 is plain HTTP and anything else, including no port at all, is TLS
+func FromRaw(raw []byte) (*Request, error) {
+	r := &Request{ID: "raw", RawRequest: raw}
+
+	if bytes.HasPrefix(raw, []byte(":")) {
+		fields, _, err := ParseH2Request(raw)
+		if err != nil {
+			return nil, err
+		}
+		scheme, authority := "https", ""
+		for _, f := range fields {
+			switch f.Name {
+			case ":scheme":
+				scheme = f.Value
+			case ":authority":
+				authority = f.Value
+			}
+		}
+		if authority == "" {
+			return nil, fmt.Errorf("no :authority in request")
+		}
+		r.Protocol = ProtoH2
+		return r, r.setDestination(&url.URL{Scheme: scheme, Host: authority})
+	}
+
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(raw)))
+	if err != nil {
+		return nil, err
+	}
+
+	if req.URL.IsAbs() {
+		return r, r.setDestination(req.URL)
+	}
+
+	if req.Host == "" {
+		return nil, fmt.Errorf("no Host header in request")
+	}
+
+	scheme := "https"
+	if _, port, err := net.SplitHostPort(req.Host); err == nil && port == "80" {
+		scheme = "http"
+	}
+	return r, r.setDestination(&url.URL{Scheme: scheme, Host: req.Host})
+}
+
+// setDestination - set the host, port and TLS flag from a URL, using the default
+// port for the scheme when there isn't one
+func (r *Request) setDestination(u *url.URL) error {
+	switch u.Scheme {
+	case "https":
+		r.TLS = true
+		r.Port = "443"
+	case "http":
+		r.TLS = false
+		r.Port = "80"
+	default:
+		return fmt.Errorf("unsupported scheme %s", u.Scheme)
+	}
+
+	r.Host = u.Hostname()
+	if port := u.Port(); port != "" {
+		r.Port = port
+	}
+	if r.Host == "" {
+		return fmt.Errorf("no host in %s", u)
+	}
+
+	return nil
+}
+
+// shellSplit - split a command line into arguments the way a POSIX shell would,
+// handling single, double and $'...' quoting, backslash escapes and line continuations
+func shellSplit(s string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inArg := false
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+
+		case c == '\\':
+			if i+1 < len(s) && s[i+1] == '\r' {
+				i++
+			}
+			if i+1 < len(s) && s[i+1] == '\n' {
+				i++ // line continuation
+				continue
+			}
+			if i+1 < len(s) {
+				i++
+				cur.WriteByte(s[i])
+				inArg = true
+			}
+
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated single quote")
+			}
+			cur.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+			inArg = true
+
+		case c == '$' && i+1 < len(s) && s[i+1] == '\'':
+			n, err := ansiCQuote(s[i+2:], &cur)
+			if err != nil {
+				return nil, err
+			}
+			i += n + 2
+			inArg = true
+
+		case c == '"':
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\\\"$`\n", s[i+1]) != -1 {
+					i++
+					if s[i] == '\n' {
+						continue
+					}
+				}
+				cur.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("unterminated double quote")
+			}
+			inArg = true
+
+		default:
+			cur.WriteByte(c)
+			inArg = true
+		}
+	}
+
+	if inArg {
+		args = append(args, cur.String())
+	}
+
+	return args, nil
+}
+
+// ansiCQuote - decode the body of a $'...' string up to the closing quote into out,
+// returning the number of bytes consumed including the closing quote
+func ansiCQuote(s string, out *strings.Builder) (int, error) {
+	simple := map[byte]byte{
+		'a': '\a', 'b': '\b', 'e': 0x1b, 'E': 0x1b, 'f': '\f', 'n': '\n', 'r': '\r',
+		't': '\t', 'v': '\v', '\\': '\\', '\'': '\'', '"': '"', '?': '?',
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\'' {
+			return i + 1, nil
+		}
+		if c != '\\' || i+1 >= len(s) {
+			out.WriteByte(c)
+			continue
+		}
+
+		i++
+		if b, ok := simple[s[i]]; ok {
+			out.WriteByte(b)
+			continue
+		}
+
+		switch s[i] {
+		case 'x':
+			n := hexDigits(s[i+1:], 2)
+			if n == 0 {
+				out.WriteString("\\x")
+				continue
+			}
+			v, _ := strconv.ParseUint(s[i+1:i+1+n], 16, 8)
+			out.WriteByte(byte(v))
+			i += n
+		case 'u', 'U':
+			digits := 4
+			if s[i] == 'U' {
+				digits = 8
+			}
+			n := hexDigits(s[i+1:], digits)
+			if n == 0 {
+				out.WriteByte('\\')
+				out.WriteByte(s[i])
+				continue
+			}
+			v, _ := strconv.ParseUint(s[i+1:i+1+n], 16, 32)
+			out.WriteRune(rune(v))
+			i += n
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			n := 1
+			for n < 3 && i+n < len(s) && s[i+n] >= '0' && s[i+n] <= '7' {
+				n++
+			}
+			v, _ := strconv.ParseUint(s[i:i+n], 8, 8)
+			out.WriteByte(byte(v))
+			i += n - 1
+		default:
+			out.WriteByte('\\')
+			out.WriteByte(s[i])
+		}
+	}
+
+	return 0, fmt.Errorf("unterminated $'...' quote")
+}
+
+// hexDigits - the number of leading hex digits in s, up to limit
+func hexDigits(s string, limit int) int {
+	n := 0
+	for n < limit && n < len(s) && strings.IndexByte("0123456789abcdefABCDEF", s[n]) != -1 {
+		n++
+	}
+	return n
+}
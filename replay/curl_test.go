@@ -0,0 +1,61 @@
+package replay
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFromCurl(t *testing.T) {
+	cmd := `curl -sk -X PUT 'https://example.com:8443/api?a=1' \
+  -H 'X-Test: one' -H "Accept:" -b 'session=abc' -u admin:secret \
+  --compressed --data-binary $'{"a":\x31}\r\n'`
+
+	r, err := FromCurl(cmd)
+	if err != nil {
+		t.Fatalf("TestFromCurl unexpected error: %v", err)
+	}
+
+	if r.Host != "example.com" || r.Port != "8443" || !r.TLS {
+		t.Errorf("TestFromCurl unexpected destination: got %v %v %v want %v %v %v", r.Host, r.Port, r.TLS, "example.com", "8443", true)
+	}
+
+	want := "PUT /api?a=1 HTTP/1.1\r\n" +
+		"Host: example.com:8443\r\n" +
+		"Content-Type: application/x-www-form-urlencoded\r\n" +
+		"X-Test: one\r\n" +
+		"Authorization: Basic YWRtaW46c2VjcmV0\r\n" +
+		"Accept-Encoding: deflate, gzip, br, zstd\r\n" +
+		"Cookie: session=abc\r\n" +
+		"Content-Length: 9\r\n" +
+		"Connection: close\r\n" +
+		"\r\n" +
+		"{\"a\":1}\r\n"
+
+	if got := string(r.RawRequest); got != want {
+		t.Errorf("TestFromCurl unexpected request: got %q want %q", got, want)
+	}
+}
+
+func TestFromRaw(t *testing.T) {
+	r, err := FromRaw([]byte("GET / HTTP/1.1\r\nHost: example.com:80\r\n\r\n"))
+	if err != nil {
+		t.Fatalf("TestFromRaw unexpected error: %v", err)
+	}
+
+	if r.Host != "example.com" || r.Port != "80" || r.TLS {
+		t.Errorf("TestFromRaw unexpected destination: got %v %v %v want %v %v %v", r.Host, r.Port, r.TLS, "example.com", "80", false)
+	}
+
+	r, err = FromRaw([]byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+	if err != nil {
+		t.Fatalf("TestFromRaw unexpected error: %v", err)
+	}
+
+	if r.Port != "443" || !r.TLS {
+		t.Errorf("TestFromRaw unexpected destination: got %v %v want %v %v", r.Port, r.TLS, "443", true)
+	}
+
+	if _, err := FromRaw([]byte("GET / HTTP/1.1\r\n\r\n")); err == nil || !strings.Contains(err.Error(), "Host") {
+		t.Errorf("TestFromRaw expected a missing Host error, got %v", err)
+	}
+}
@@ -0,0 +1,464 @@
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+const (
+	ProtoHTTP1      = ""    // raw HTTP/1.x bytes
+	ProtoH2         = "h2"  // HTTP/2 over TLS via ALPN, or cleartext with prior knowledge
+	ProtoH2CUpgrade = "h2c" // cleartext HTTP/2 negotiated with an HTTP/1.1 Upgrade
+)
+
+// settings we send in our preface, push is disabled so the server doesn't open streams
+var h2Settings = []http2.Setting{{ID: http2.SettingEnablePush, Val: 0}}
+
+// ParseH2Request - split an HTTP/2 request written as "name: value" lines into header
+// fields and a body. Pseudo-headers are written like any other header, eg ":method: GET".
+// Names are kept exactly as written so casing, duplicates and invalid pseudo-headers
+// all go out on the wire. The body is everything after the first blank line
+func ParseH2Request(raw []byte) ([]hpack.HeaderField, []byte, error) {
+	var fields []hpack.HeaderField
+
+	rest := raw
+	for len(rest) > 0 {
+		var line []byte
+		line, rest, _ = bytes.Cut(rest, []byte("\n"))
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if len(line) == 0 {
+			return fields, rest, nil
+		}
+
+		// skip the leading colon of pseudo-headers when looking for the separator
+		sep := bytes.IndexByte(line[1:], ':')
+		if sep == -1 {
+			return nil, nil, fmt.Errorf("bad header line %q", line)
+		}
+		sep++
+
+		fields = append(fields, hpack.HeaderField{
+			Name:  string(line[:sep]),
+			Value: strings.TrimLeft(string(line[sep+1:]), " "),
+		})
+	}
+
+	return fields, nil, nil
+}
+
+// ToH2Request - convert a raw HTTP/1.x request into the HTTP/2 request format used by
+// ParseH2Request. Connection specific headers are dropped and Host becomes :authority
+func ToH2Request(raw []byte, tls bool) []byte {
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(raw)))
+	if err != nil {
+		return raw
+	}
+
+	head, body, _ := bytes.Cut(raw, []byte("\r\n\r\n"))
+	lines := strings.Split(string(head), "\r\n")
+
+	scheme := "http"
+	if tls {
+		scheme = "https"
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, ":method: %s\r\n", req.Method)
+	fmt.Fprintf(&b, ":path: %s\r\n", req.RequestURI)
+	fmt.Fprintf(&b, ":authority: %s\r\n", req.Host)
+	fmt.Fprintf(&b, ":scheme: %s\r\n", scheme)
+
+	for _, line := range lines[1:] {
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		switch strings.ToLower(name) {
+		case "host", "connection", "keep-alive", "proxy-connection", "transfer-encoding", "upgrade":
+			continue
+		}
+		fmt.Fprintf(&b, "%s: %s\r\n", strings.ToLower(name), strings.TrimSpace(value))
+	}
+	b.WriteString("\r\n")
+	b.Write(body)
+
+	return b.Bytes()
+}
+
+// sendH2 - send the request over HTTP/2 on stream 1. The returned buffer holds the
+// response rebuilt as text, and a log of every frame sent and received is stored
+// in r.Frames
+func (r *Request) sendH2() (bytes.Buffer, error) {
+	var buf bytes.Buffer
+	var frames strings.Builder
+
+	fields, body, err := ParseH2Request(r.RawRequest)
+	if err != nil {
+		log.Printf("[!] Replay sendH2: %s\n", err)
+		return buf, err
+	}
+
+	conn, err := r.dial()
+	if err != nil {
+		log.Printf("[!] Replay sendH2: %s\n", err)
+		return buf, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	var reader io.Reader = conn
+	upgraded := false
+
+	if r.Protocol == ProtoH2CUpgrade && !r.TLS {
+		br := bufio.NewReader(conn)
+		res, raw, err := h2cUpgrade(conn, br, fields, body)
+		if err != nil {
+			log.Printf("[!] Replay sendH2 - upgrade: %s\n", err)
+			return buf, err
+		}
+		if res.StatusCode != http.StatusSwitchingProtocols {
+			// the server didn't want to upgrade, hand back the HTTP/1.1 response
+			buf.Write(raw)
+			return buf, nil
+		}
+		fmt.Fprintf(&frames, "<< HTTP/1.1 101 upgrade to h2c\n")
+		reader = br
+		upgraded = true
+	}
+
+	if tc, ok := conn.(*tls.Conn); ok && tc.ConnectionState().NegotiatedProtocol != "h2" {
+		fmt.Fprintf(&frames, "!! ALPN did not negotiate h2, continuing with prior knowledge\n")
+	}
+
+	fr := http2.NewFramer(conn, reader)
+	fr.AllowIllegalWrites = true
+	fr.AllowIllegalReads = true
+
+	if _, err := conn.Write([]byte(http2.ClientPreface)); err != nil {
+		return buf, err
+	}
+	fr.WriteSettings(h2Settings...)
+	fmt.Fprintf(&frames, ">> SETTINGS stream=0\n")
+
+	// an upgraded connection sends the request as the HTTP/1.1 upgrade request
+	if !upgraded {
+		if _, err := r.writeH2Request(fr, &frames, 1, fields, body, false); err != nil {
+			log.Printf("[!] Replay sendH2: %s\n", err)
+			return buf, err
+		}
+	}
+
+	res, err := readH2Response(fr, &frames)
+	r.Frames = frames.String()
+	buf.Write(res)
+
+	log.Printf("[+] Replay - sendH2 - Received: %d\n", buf.Len())
+	return buf, err
+}
+
+// writeH2Request - write the HEADERS (and CONTINUATION) and DATA frames for a stream.
+// With hold set the stream is left open and the payload of its final DATA frame, the
+// last byte of the body or nothing, is returned for the caller to send
+func (r *Request) writeH2Request(fr *http2.Framer, frames *strings.Builder, id uint32, fields []hpack.HeaderField, body []byte, hold bool) ([]byte, error) {
+	var block bytes.Buffer
+	enc := hpack.NewEncoder(&block)
+	for _, f := range fields {
+		if err := enc.WriteField(f); err != nil {
+			return nil, err
+		}
+	}
+
+	var final []byte
+	if hold && len(body) > 0 {
+		body, final = body[:len(body)-1], body[len(body)-1:]
+	}
+
+	// split the header block into CONTINUATION frames if asked to
+	fragments := [][]byte{block.Bytes()}
+	if r.H2HeaderSplit > 0 {
+		fragments = nil
+		b := block.Bytes()
+		for len(b) > r.H2HeaderSplit {
+			fragments = append(fragments, b[:r.H2HeaderSplit])
+			b = b[r.H2HeaderSplit:]
+		}
+		fragments = append(fragments, b)
+	}
+
+	err := fr.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      id,
+		BlockFragment: fragments[0],
+		EndStream:     len(body) == 0 && !hold,
+		EndHeaders:    len(fragments) == 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(frames, ">> HEADERS stream=%d len=%d\n", id, len(fragments[0]))
+	for _, f := range fields {
+		fmt.Fprintf(frames, "   %s: %s\n", f.Name, f.Value)
+	}
+
+	for i, fragment := range fragments[1:] {
+		if err := fr.WriteContinuation(id, i == len(fragments)-2, fragment); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(frames, ">> CONTINUATION stream=%d len=%d\n", id, len(fragment))
+	}
+
+	for len(body) > 0 {
+		chunk := body
+		if len(chunk) > 16384 {
+			chunk = chunk[:16384]
+		}
+		body = body[len(chunk):]
+		if err := fr.WriteData(id, len(body) == 0 && !hold, chunk); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(frames, ">> DATA stream=%d len=%d\n", id, len(chunk))
+	}
+
+	return final, nil
+}
+
+// h2Stream - a response being read off an HTTP/2 connection
+type h2Stream struct {
+	res, body, trailers bytes.Buffer
+	seenFinal           bool
+	ended               bool
+	end                 time.Time // when the stream ended
+}
+
+// bytes - the response rebuilt as text, only call it once the stream has been read
+func (s *h2Stream) bytes() []byte {
+	return h2Rebuild(&s.res, &s.body, &s.trailers)
+}
+
+// readH2Response - read frames until stream 1 is finished, answering SETTINGS and PING
+// frames along the way. The response is rebuilt as text in an HTTP/1 like layout
+func readH2Response(fr *http2.Framer, frames *strings.Builder) ([]byte, error) {
+	s := new(h2Stream)
+	err := readH2Streams(fr, frames, map[uint32]*h2Stream{1: s})
+	return s.bytes(), err
+}
+
+// readH2Streams - read frames until every one of streams has finished, or the
+// connection ends, answering SETTINGS and PING frames along the way
+func readH2Streams(fr *http2.Framer, frames *strings.Builder, streams map[uint32]*h2Stream) error {
+	var block []byte
+	var endAfterBlock bool
+	dec := hpack.NewDecoder(4096, nil)
+	open := len(streams)
+
+	endStream := func(id uint32) {
+		if s, ok := streams[id]; ok && !s.ended {
+			s.ended = true
+			s.end = time.Now()
+			open--
+		}
+	}
+
+	for open > 0 {
+		f, err := fr.ReadFrame()
+		if err != nil {
+			if errors.Is(err, io.EOF) || isTimeout(err) {
+				err = nil
+			}
+			fmt.Fprintf(frames, "!! %s\n", errOrEnd(err))
+			return err
+		}
+
+		h := f.Header()
+		fmt.Fprintf(frames, "<< %s stream=%d len=%d\n", h.Type, h.StreamID, h.Length)
+
+		switch f := f.(type) {
+		case *http2.SettingsFrame:
+			if !f.IsAck() {
+				f.ForeachSetting(func(s http2.Setting) error {
+					fmt.Fprintf(frames, "   %s\n", s)
+					return nil
+				})
+				fr.WriteSettingsAck()
+				fmt.Fprintf(frames, ">> SETTINGS ACK\n")
+			}
+
+		case *http2.PingFrame:
+			if !f.IsAck() {
+				fr.WritePing(true, f.Data)
+			}
+
+		case *http2.HeadersFrame, *http2.ContinuationFrame:
+			var endHeaders bool
+			if hf, ok := f.(*http2.HeadersFrame); ok {
+				block = append(block[:0], hf.HeaderBlockFragment()...)
+				endHeaders = hf.HeadersEnded()
+				endAfterBlock = hf.StreamEnded()
+			} else {
+				cf := f.(*http2.ContinuationFrame)
+				block = append(block, cf.HeaderBlockFragment()...)
+				endHeaders = cf.HeadersEnded()
+			}
+			if !endHeaders {
+				continue
+			}
+
+			fields, err := dec.DecodeFull(block)
+			if err != nil {
+				fmt.Fprintf(frames, "!! hpack: %s\n", err)
+			} else {
+				for _, field := range fields {
+					fmt.Fprintf(frames, "   %s: %s\n", field.Name, field.Value)
+				}
+				if s, ok := streams[h.StreamID]; ok {
+					s.seenFinal = h2WriteHeaders(&s.res, &s.trailers, fields, s.seenFinal)
+				}
+			}
+			if endAfterBlock {
+				endStream(h.StreamID)
+			}
+
+		case *http2.DataFrame:
+			if s, ok := streams[f.StreamID]; ok {
+				s.body.Write(f.Data())
+				if f.StreamEnded() {
+					endStream(f.StreamID)
+				}
+			}
+			// keep the flow control windows open
+			if n := uint32(len(f.Data())); n > 0 {
+				fr.WriteWindowUpdate(0, n)
+				fr.WriteWindowUpdate(f.StreamID, n)
+			}
+
+		case *http2.RSTStreamFrame:
+			fmt.Fprintf(frames, "   %s\n", f.ErrCode)
+			endStream(f.StreamID)
+
+		case *http2.GoAwayFrame:
+			fmt.Fprintf(frames, "   %s %s\n", f.ErrCode, f.DebugData())
+			for id := range streams {
+				endStream(id)
+			}
+		}
+	}
+
+	return nil
+}
+
+// h2WriteHeaders - write a decoded header block. Blocks with a :status start a new
+// response (informational responses come first), a block without one is trailers
+func h2WriteHeaders(res, trailers *bytes.Buffer, fields []hpack.HeaderField, seenFinal bool) bool {
+	status := ""
+	for _, f := range fields {
+		if f.Name == ":status" {
+			status = f.Value
+		}
+	}
+
+	if status == "" && seenFinal {
+		for _, f := range fields {
+			fmt.Fprintf(trailers, "%s: %s\r\n", f.Name, f.Value)
+		}
+		return seenFinal
+	}
+
+	fmt.Fprintf(res, "HTTP/2 %s\r\n", status)
+	for _, f := range fields {
+		if f.Name != ":status" {
+			fmt.Fprintf(res, "%s: %s\r\n", f.Name, f.Value)
+		}
+	}
+	res.WriteString("\r\n")
+
+	code, _ := strconv.Atoi(status)
+	return code >= 200 || seenFinal
+}
+
+func h2Rebuild(res, body, trailers *bytes.Buffer) []byte {
+	res.Write(body.Bytes())
+	if trailers.Len() > 0 {
+		res.WriteString("\r\n")
+		res.Write(trailers.Bytes())
+	}
+	return res.Bytes()
+}
+
+// h2cUpgrade - send the request as an HTTP/1.1 request asking to upgrade to h2c. The
+// response to the request arrives on stream 1 if the server switches protocols
+func h2cUpgrade(conn net.Conn, br *bufio.Reader, fields []hpack.HeaderField, body []byte) (*http.Response, []byte, error) {
+	var method, path, authority string
+	var headers bytes.Buffer
+	for _, f := range fields {
+		switch f.Name {
+		case ":method":
+			method = f.Value
+		case ":path":
+			path = f.Value
+		case ":authority":
+			authority = f.Value
+		case ":scheme":
+		default:
+			fmt.Fprintf(&headers, "%s: %s\r\n", f.Name, f.Value)
+		}
+	}
+
+	var settings bytes.Buffer
+	sf := http2.NewFramer(&settings, nil)
+	sf.WriteSettings(h2Settings...)
+	payload := settings.Bytes()[9:] // strip the frame header
+
+	var req bytes.Buffer
+	fmt.Fprintf(&req, "%s %s HTTP/1.1\r\n", method, path)
+	fmt.Fprintf(&req, "Host: %s\r\n", authority)
+	req.Write(headers.Bytes())
+	if len(body) > 0 {
+		fmt.Fprintf(&req, "Content-Length: %d\r\n", len(body))
+	}
+	req.WriteString("Connection: Upgrade, HTTP2-Settings\r\n")
+	req.WriteString("Upgrade: h2c\r\n")
+	fmt.Fprintf(&req, "HTTP2-Settings: %s\r\n\r\n", base64.RawURLEncoding.EncodeToString(payload))
+	req.Write(body)
+
+	if _, err := conn.Write(req.Bytes()); err != nil {
+		return nil, nil, err
+	}
+
+	// 1xx responses have no body, so the h2 frames that follow a 101 stay in br
+	res, err := http.ReadResponse(br, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if res.StatusCode == http.StatusSwitchingProtocols {
+		return res, nil, nil
+	}
+
+	raw, err := httputil.DumpResponse(res, true)
+	return res, raw, err
+}
+
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+func errOrEnd(err error) string {
+	if err == nil {
+		return "connection closed"
+	}
+	return err.Error()
+}
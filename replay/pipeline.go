@@ -0,0 +1,147 @@
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// PipelineStep - a single raw request sent over a shared connection
+type PipelineStep struct {
+	Raw  []byte        // the raw request bytes
+	Wait time.Duration // how long to pause before writing this request
+}
+
+// PipelineResponse - a single response split out of a pipelined response stream
+type PipelineResponse struct {
+	Offset int    // offset of the response within the stream
+	Raw    []byte // the raw response bytes
+	Status int    // the response status code
+}
+
+// ErrPipelineH2 - pipelining writes raw HTTP/1.x requests back to back, HTTP/2 requests
+// would go out as text on a connection that may have negotiated h2
+var ErrPipelineH2 = errors.New("HTTP/2 requests can't be pipelined, race them or send them one at a time")
+
+// SendPipeline - write every step over a single connection to the request's destination,
+// either back to back or with the configured pauses between them. The whole response
+// stream is returned, reading stops once the server closes the connection or goes
+// quiet for idle after the final step has been written
+func (r *Request) SendPipeline(steps []PipelineStep, idle time.Duration) ([]byte, error) {
+	var buf bytes.Buffer
+	log.Printf("[+] Replay - SendPipeline Host: %s Port: %s TLS: %t Steps: %d\n", r.Host, r.Port, r.TLS, len(steps))
+
+	if r.Protocol != ProtoHTTP1 {
+		return nil, ErrPipelineH2
+	}
+
+	conn, err := r.dial()
+	if err != nil {
+		log.Printf("[!] Replay SendPipeline: %s\n", err)
+		return nil, err
+	}
+	defer conn.Close()
+
+	var total time.Duration
+	for _, step := range steps {
+		total += step.Wait
+	}
+	conn.SetReadDeadline(time.Now().Add(total + 30*time.Second))
+
+	var written atomic.Bool
+	done := make(chan error, 1)
+	go func() {
+		chunk := make([]byte, 32*1024)
+		for {
+			n, err := conn.Read(chunk)
+			buf.Write(chunk[:n])
+			if err != nil {
+				if err == io.EOF {
+					err = nil
+				}
+				done <- err
+				return
+			}
+			if written.Load() {
+				conn.SetReadDeadline(time.Now().Add(idle))
+			}
+		}
+	}()
+
+	for i, step := range steps {
+		if step.Wait > 0 {
+			time.Sleep(step.Wait)
+		}
+		if _, err := conn.Write(step.Raw); err != nil {
+			log.Printf("[!] Replay SendPipeline - step %d: %s\n", i+1, err)
+			break
+		}
+	}
+	written.Store(true)
+	conn.SetReadDeadline(time.Now().Add(idle))
+
+	err = <-done
+	log.Printf("[+] Replay - SendPipeline - Received: %d\n", buf.Len())
+
+	if buf.Len() > 0 {
+		// a read timeout is how keep-alive streams end, only report it if nothing came back
+		return buf.Bytes(), nil
+	}
+	return nil, err
+}
+
+// SplitResponses - split a raw response stream into individual responses. methods holds
+// the request method of each pipelined request, in order, so that responses to HEAD
+// requests are parsed without a body. Any bytes that can't be parsed as a response
+// are returned as leftover
+func SplitResponses(stream []byte, methods []string) (responses []PipelineResponse, leftover []byte) {
+	offset := 0
+	request := 0
+
+	for offset < len(stream) {
+		method := http.MethodGet
+		if request < len(methods) {
+			method = methods[request]
+		}
+
+		reader := bytes.NewReader(stream[offset:])
+		br := bufio.NewReader(reader)
+		res, err := http.ReadResponse(br, &http.Request{Method: method})
+		if err != nil {
+			break
+		}
+		_, err = io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+		if err != nil {
+			break
+		}
+
+		consumed := len(stream[offset:]) - reader.Len() - br.Buffered()
+		if consumed <= 0 {
+			break
+		}
+
+		responses = append(responses, PipelineResponse{
+			Offset: offset,
+			Raw:    stream[offset : offset+consumed],
+			Status: res.StatusCode,
+		})
+		offset += consumed
+
+		// interim responses don't answer a request
+		if res.StatusCode >= 200 || res.StatusCode == http.StatusSwitchingProtocols {
+			request++
+		}
+	}
+
+	if offset < len(stream) {
+		leftover = stream[offset:]
+	}
+
+	return responses, leftover
+}
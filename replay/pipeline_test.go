@@ -0,0 +1,39 @@
+package replay
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSplitResponses(t *testing.T) {
+	stream := "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello" +
+		"HTTP/1.1 200 OK\r\nContent-Length: 100\r\n\r\n" + // response to a HEAD, no body follows
+		"HTTP/1.1 404 Not Found\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n0\r\n\r\n" +
+		"GARBAGE"
+
+	responses, leftover := SplitResponses([]byte(stream), []string{"GET", "HEAD", "GET"})
+
+	if l := len(responses); l != 3 {
+		t.Fatalf("TestSplitResponses unexpected number of responses: got %v want %v", l, 3)
+	}
+
+	if s := responses[2].Status; s != 404 {
+		t.Errorf("TestSplitResponses unexpected status: got %v want %v", s, 404)
+	}
+
+	if o := responses[1].Offset; o != 43 {
+		t.Errorf("TestSplitResponses unexpected offset: got %v want %v", o, 43)
+	}
+
+	if string(leftover) != "GARBAGE" {
+		t.Errorf("TestSplitResponses unexpected leftover: got %q want %q", leftover, "GARBAGE")
+	}
+}
+
+func TestSendPipelineH2(t *testing.T) {
+	r := &Request{Host: "127.0.0.1", Port: "1", Protocol: ProtoH2, RawRequest: []byte(":method: GET\r\n:path: /\r\n\r\n")}
+
+	if _, err := r.SendPipeline([]PipelineStep{{Raw: r.RawRequest}}, time.Second); err != ErrPipelineH2 {
+		t.Errorf("TestSendPipelineH2 got %v want %v", err, ErrPipelineH2)
+	}
+}
@@ -0,0 +1,233 @@
+package replay
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// RaceResult - the outcome of a single request sent as part of a race
+type RaceResult struct {
+	Request  *Request      // the request that was sent
+	Response []byte        // the raw response
+	Offset   time.Duration // when the final byte was written, relative to the release
+	Duration time.Duration // time from writing the final byte to the end of the response
+	Err      error         // any error hit while sending
+}
+
+// ErrRaceUpgrade - h2c upgrade requests are sent as the HTTP/1.1 upgrade request itself,
+// so there's no final frame to hold back
+var ErrRaceUpgrade = errors.New("h2c upgrade requests can't be raced, use h2 for prior knowledge instead")
+
+// SendRace - fire all of the requests as close to simultaneously as possible. HTTP/1.x
+// requests each get a connection, opened up front, with everything but the last byte
+// written. HTTP/2 requests to the same destination share a connection, a stream each,
+// with every stream's final DATA frame held back so they can all go out in one packet.
+// Once every connection is staged, the final bytes are released together
+func SendRace(reqs []*Request) []RaceResult {
+	results := make([]RaceResult, len(reqs))
+
+	log.Printf("[+] Replay - SendRace - Staging %d requests\n", len(reqs))
+
+	var groups [][]int
+	group := make(map[string]int)
+	for i, r := range reqs {
+		results[i].Request = r
+
+		switch r.Protocol {
+		case ProtoH2:
+			key := fmt.Sprintf("%s %s %t", r.Host, r.Port, r.TLS)
+			g, ok := group[key]
+			if !ok {
+				g = len(groups)
+				group[key] = g
+				groups = append(groups, nil)
+			}
+			groups[g] = append(groups[g], i)
+		case ProtoH2CUpgrade:
+			results[i].Err = ErrRaceUpgrade
+		default:
+			groups = append(groups, []int{i})
+		}
+	}
+
+	// each connection is staged in its own goroutine, which then waits for the release
+	release := make(chan struct{})
+	var staged, done sync.WaitGroup
+	var start time.Time
+	for _, g := range groups {
+		staged.Add(1)
+		done.Add(1)
+		if reqs[g[0]].Protocol == ProtoH2 {
+			go raceH2(reqs, results, g, &staged, &done, release, &start)
+		} else {
+			go raceHTTP1(reqs[g[0]], &results[g[0]], &staged, &done, release, &start)
+		}
+	}
+
+	staged.Wait()
+	start = time.Now()
+	close(release)
+	done.Wait()
+
+	log.Printf("[+] Replay - SendRace - Race complete\n")
+
+	return results
+}
+
+// raceHTTP1 - stage a request on its own connection by writing all but its last byte,
+// then write the last byte on release and read the response
+func raceHTTP1(r *Request, result *RaceResult, staged, done *sync.WaitGroup, release chan struct{}, start *time.Time) {
+	defer done.Done()
+
+	conn, err := stageHTTP1(r)
+	staged.Done()
+	if err != nil {
+		result.Err = err
+		return
+	}
+	defer conn.Close()
+
+	last := r.RawRequest[len(r.RawRequest)-1:]
+	<-release
+
+	sent := time.Now()
+	if _, err := conn.Write(last); err != nil {
+		result.Err = err
+		return
+	}
+	result.Offset = sent.Sub(*start)
+
+	var buf bytes.Buffer
+	conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+	_, err = io.Copy(&buf, conn)
+	result.Duration = time.Since(sent)
+	result.Response = buf.Bytes()
+	if err != nil && buf.Len() == 0 {
+		result.Err = err
+	}
+}
+
+func stageHTTP1(r *Request) (net.Conn, error) {
+	if len(r.RawRequest) == 0 {
+		return nil, io.ErrShortWrite
+	}
+
+	conn, err := r.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.Write(r.RawRequest[:len(r.RawRequest)-1]); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// raceH2 - stage the HTTP/2 requests in g on one connection, then send every stream's
+// final DATA frame in a single write on release and read the responses
+func raceH2(reqs []*Request, results []RaceResult, g []int, staged, done *sync.WaitGroup, release chan struct{}, start *time.Time) {
+	defer done.Done()
+
+	var frames strings.Builder
+	conn, fr, err := dialH2(reqs[g[0]], &frames)
+	if err != nil {
+		staged.Done()
+		for _, i := range g {
+			results[i].Err = err
+		}
+		return
+	}
+	defer conn.Close()
+
+	// stage every request on its own stream, holding back the final DATA frame
+	var packet bytes.Buffer
+	pf := http2.NewFramer(&packet, nil)
+	streams := make(map[uint32]*h2Stream)
+	ids := make([]uint32, len(g))
+	for n, i := range g {
+		r := reqs[i]
+		fields, body, err := ParseH2Request(r.RawRequest)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		id := uint32(2*n + 1)
+		final, err := r.writeH2Request(fr, &frames, id, fields, body, true)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		pf.WriteData(id, true, final)
+		ids[n] = id
+		streams[id] = new(h2Stream)
+	}
+	staged.Done()
+
+	<-release
+
+	sent := time.Now()
+	if _, err := conn.Write(packet.Bytes()); err != nil {
+		for n, i := range g {
+			if ids[n] != 0 {
+				results[i].Err = err
+			}
+		}
+		return
+	}
+	fmt.Fprintf(&frames, ">> DATA END_STREAM on %d streams in one write, %d bytes\n", len(streams), packet.Len())
+
+	conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+	err = readH2Streams(fr, &frames, streams)
+
+	for n, i := range g {
+		s, ok := streams[ids[n]]
+		if !ok {
+			continue
+		}
+
+		results[i].Offset = sent.Sub(*start)
+		results[i].Response = s.bytes()
+		if s.ended {
+			results[i].Duration = s.end.Sub(sent)
+		} else {
+			results[i].Duration = time.Since(sent)
+		}
+		if err != nil && len(results[i].Response) == 0 {
+			results[i].Err = err
+		}
+		reqs[i].Frames = frames.String()
+	}
+}
+
+// dialH2 - open an HTTP/2 connection to the request's destination and send the preface
+func dialH2(r *Request, frames *strings.Builder) (net.Conn, *http2.Framer, error) {
+	conn, err := r.dial()
+	if err != nil {
+		return nil, nil, err
+	}
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	fr := http2.NewFramer(conn, conn)
+	fr.AllowIllegalWrites = true
+	fr.AllowIllegalReads = true
+
+	if _, err := conn.Write([]byte(http2.ClientPreface)); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	fr.WriteSettings(h2Settings...)
+	fmt.Fprintf(frames, ">> SETTINGS stream=0\n")
+
+	return conn, fr, nil
+}
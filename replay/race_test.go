@@ -0,0 +1,108 @@
+package replay
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// raceServer - a loopback server recording the bodies it receives and which
+// connection each came in on
+func raceServer(t *testing.T, h2 bool) (*httptest.Server, func() ([]string, map[string]bool)) {
+	var mu sync.Mutex
+	var bodies []string
+	conns := make(map[string]bool)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		conns[r.RemoteAddr] = true
+		mu.Unlock()
+		io.WriteString(w, "ok")
+	}))
+	if h2 {
+		srv.Config.Protocols = new(http.Protocols)
+		srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	return srv, func() ([]string, map[string]bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		return bodies, conns
+	}
+}
+
+func raceRequests(t *testing.T, srv *httptest.Server, raw string, proto string, n int) []*Request {
+	host, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reqs []*Request
+	for i := 0; i < n; i++ {
+		reqs = append(reqs, &Request{Host: host, Port: port, RawRequest: []byte(raw), Protocol: proto})
+	}
+	return reqs
+}
+
+func TestSendRace(t *testing.T) {
+	srv, received := raceServer(t, false)
+	reqs := raceRequests(t, srv, "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 5\r\nConnection: close\r\n\r\nhello", ProtoHTTP1, 5)
+
+	for i, res := range SendRace(reqs) {
+		if res.Err != nil || !strings.HasPrefix(string(res.Response), "HTTP/1.1 200") {
+			t.Errorf("TestSendRace request %d got %q %v want a 200", i, res.Response, res.Err)
+		}
+	}
+
+	bodies, _ := received()
+	if len(bodies) != 5 {
+		t.Fatalf("TestSendRace server got %d requests want 5", len(bodies))
+	}
+	for _, b := range bodies {
+		if b != "hello" {
+			t.Errorf("TestSendRace server got body %q want %q", b, "hello")
+		}
+	}
+}
+
+func TestSendRaceH2(t *testing.T) {
+	srv, received := raceServer(t, true)
+	post := raceRequests(t, srv, ":method: POST\r\n:path: /\r\n:authority: x\r\n:scheme: http\r\n\r\nhello", ProtoH2, 3)
+	get := raceRequests(t, srv, ":method: GET\r\n:path: /\r\n:authority: x\r\n:scheme: http\r\n\r\n", ProtoH2, 2)
+
+	for i, res := range SendRace(append(post, get...)) {
+		if res.Err != nil || !strings.HasPrefix(string(res.Response), "HTTP/2 200") || !strings.HasSuffix(string(res.Response), "ok") {
+			t.Errorf("TestSendRaceH2 request %d got %q %v want a 200", i, res.Response, res.Err)
+		}
+	}
+
+	bodies, conns := received()
+	if len(bodies) != 5 || len(conns) != 1 {
+		t.Fatalf("TestSendRaceH2 server got %d requests on %d connections want 5 on 1", len(bodies), len(conns))
+	}
+	hellos := 0
+	for _, b := range bodies {
+		if b == "hello" {
+			hellos++
+		}
+	}
+	if hellos != 3 {
+		t.Errorf("TestSendRaceH2 server got bodies %q want 3 hello", bodies)
+	}
+}
+
+func TestSendRaceUpgrade(t *testing.T) {
+	r := &Request{Host: "127.0.0.1", Port: "1", Protocol: ProtoH2CUpgrade, RawRequest: []byte(":method: GET\r\n:path: /\r\n\r\n")}
+
+	if res := SendRace([]*Request{r}); res[0].Err != ErrRaceUpgrade {
+		t.Errorf("TestSendRaceUpgrade got %v want %v", res[0].Err, ErrRaceUpgrade)
+	}
+}
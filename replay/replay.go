@@ -2,15 +2,17 @@ package replay
 
 import (
 	"bytes"
-	"crypto/tls"
+	"context"
 	"io"
 	"log"
 	"net"
 	"os"
+	"slices"
 	"strconv"
-	"strings"
 	"time"
 
+	"github.com/denandz/glorp/dialer"
+
 	"github.com/fsnotify/fsnotify"
 )
 
@@ -23,6 +25,15 @@ type Request struct {
 	RawRequest   []byte // the raw body
 	RawResponse  []byte // the raw body
 	ResponseTime string // the time it took to recieve the response
+	Template     []byte `json:",omitempty"` // the request before chain variables were substituted in
+
+	Protocol      string `json:",omitempty"` // ProtoHTTP1, ProtoH2 or ProtoH2CUpgrade
+	H2HeaderSplit int    `json:",omitempty"` // split the HTTP/2 header block into CONTINUATION frames of this size
+	Frames        string `json:",omitempty"` // log of the HTTP/2 frames from the last send
+
+	TLSOptions TLSOptions `json:",omitzero"`  // SNI, version, cipher, ALPN and client certificate settings
+	TLSState   *TLSState  `json:",omitempty"` // parameters negotiated on the last TLS send
+	RemoteAddr string     `json:",omitempty"` // the address the last send connected to
 
 	ExternalFile *os.File          `json:"-"` // external file that is currently used to update the request
 	Watcher      *fsnotify.Watcher `json:"-"` // watcher for external file updates
@@ -40,11 +51,16 @@ func (r *Request) SendRequest() (int, error) {
 		return 0, err
 	}
 
+	r.Frames = ""
+	r.TLSState = nil
+	r.RemoteAddr = ""
 	start := time.Now()
-	if !r.TLS {
-		buf, err = sendTCP(r.Host, port, r.RawRequest)
+	if r.Protocol == ProtoH2 || r.Protocol == ProtoH2CUpgrade {
+		buf, err = r.sendH2()
+	} else if !r.TLS {
+		buf, err = r.sendTCP(port)
 	} else {
-		buf, err = sendTLS(r.Host, port, r.RawRequest)
+		buf, err = r.sendTLS(port)
 	}
 
 	size := buf.Len()
@@ -105,17 +121,20 @@ func (r *Request) Copy() Request {
 	replayData.RawResponse = make([]byte, len(r.RawResponse))
 	copy(replayData.RawRequest, r.RawRequest)
 	copy(replayData.RawResponse, r.RawResponse)
+	if r.Template != nil {
+		replayData.Template = make([]byte, len(r.Template))
+		copy(replayData.Template, r.Template)
+	}
+	replayData.TLSOptions.Ciphers = slices.Clone(r.TLSOptions.Ciphers)
+	replayData.TLSOptions.ALPN = slices.Clone(r.TLSOptions.ALPN)
 
 	return replayData
 }
 
-func sendTCP(host string, port int, packet []byte) (bytes.Buffer, error) {
+func (r *Request) sendTCP(port int) (bytes.Buffer, error) {
 	var buf bytes.Buffer
-	var conn net.Conn
-
-	addr := strings.Join([]string{host, strconv.Itoa(port)}, ":")
-	conn, err := net.DialTimeout("tcp", addr, 30*time.Second)
 
+	conn, err := r.dialTCP(port)
 	if err != nil {
 		log.Printf("[!] Replay sendTCP: %s\n", err)
 		return buf, err
@@ -127,7 +146,7 @@ func sendTCP(host string, port int, packet []byte) (bytes.Buffer, error) {
 	}
 	defer conn.Close()
 
-	l, err := conn.Write(packet)
+	l, err := conn.Write(r.RawRequest)
 	if err != nil {
 		log.Printf("[!] Replay sendTCP: %s\n", err)
 		return buf, err
@@ -146,19 +165,10 @@ func sendTCP(host string, port int, packet []byte) (bytes.Buffer, error) {
 	return buf, nil
 }
 
-func sendTLS(host string, port int, packet []byte) (bytes.Buffer, error) {
+func (r *Request) sendTLS(port int) (bytes.Buffer, error) {
 	var buf bytes.Buffer
 
-	conf := &tls.Config{
-		// No certificate verification
-		InsecureSkipVerify: true,
-	}
-
-	addr := strings.Join([]string{host, strconv.Itoa(port)}, ":")
-
-	d := net.Dialer{Timeout: 30 * time.Second}
-
-	tlsConn, err := tls.DialWithDialer(&d, "tcp", addr, conf)
+	tlsConn, err := r.dialTLS(port, nil)
 	if err != nil {
 		log.Printf("[!] Replay sendTLS: %s\n", err)
 		return buf, err
@@ -170,7 +180,7 @@ func sendTLS(host string, port int, packet []byte) (bytes.Buffer, error) {
 	}
 	defer tlsConn.Close()
 
-	l, err := tlsConn.Write(packet)
+	l, err := tlsConn.Write(r.RawRequest)
 	if err != nil {
 		log.Printf("[!] Replay sendTLS: %s\n", err)
 		return buf, err
@@ -183,3 +193,38 @@ func sendTLS(host string, port int, packet []byte) (bytes.Buffer, error) {
 
 	return buf, nil
 }
+
+// dialTCP - open a plain TCP connection to the destination, following the routing rules
+// and hostname overrides, and record the address it connected to
+func (r *Request) dialTCP(port int) (net.Conn, error) {
+	conn, err := dialer.DialRoute(context.Background(), "tcp", net.JoinHostPort(r.Host, strconv.Itoa(port)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	r.RemoteAddr = conn.RemoteAddr().String()
+	return conn, nil
+}
+
+// dial - open a connection to the request's destination, negotiating TLS if required
+func (r *Request) dial() (net.Conn, error) {
+	port, err := strconv.Atoi(r.Port)
+	if err != nil {
+		return nil, err
+	}
+
+	if !r.TLS {
+		return r.dialTCP(port)
+	}
+
+	var alpn []string
+	if r.Protocol == ProtoH2 {
+		alpn = []string{"h2"}
+	}
+
+	conn, err := r.dialTLS(port, alpn)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
@@ -0,0 +1,195 @@
+package replay
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/denandz/glorp/dialer"
+)
+
+// TLSVersions - the TLS versions that can be pinned, in order
+var TLSVersions = []string{"1.0", "1.1", "1.2", "1.3"}
+
+var tlsVersionIDs = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSOptions - per request TLS settings, empty values use the Go defaults
+type TLSOptions struct {
+	SNI        string   `json:",omitempty"` // server name sent in the client hello, defaults to the host
+	MinVersion string   `json:",omitempty"` // minimum TLS version, one of TLSVersions
+	MaxVersion string   `json:",omitempty"` // maximum TLS version, one of TLSVersions
+	Ciphers    []string `json:",omitempty"` // cipher suite names to offer, TLS 1.3 suites can't be restricted
+	ALPN       []string `json:",omitempty"` // ALPN protocols to offer, replaces the protocol default
+	ClientCert string   `json:",omitempty"` // path to a PEM client certificate
+	ClientKey  string   `json:",omitempty"` // path to the PEM key for ClientCert
+}
+
+// TLSState - the parameters negotiated with the server on the last send
+type TLSState struct {
+	Version     string
+	CipherSuite string
+	ALPN        string
+	ServerName  string
+	Chain       []TLSCertificate
+	Verify      string // certificate verification result, "ok" or the error, empty when verification is off
+}
+
+// TLSCertificate - a summary of a certificate presented by the server
+type TLSCertificate struct {
+	Subject   string
+	Issuer    string
+	NotBefore time.Time
+	NotAfter  time.Time
+	DNSNames  []string
+	SHA256    string
+}
+
+// Config - build the tls.Config for a connection. alpn is the default protocol list
+// for the request, it's replaced by the ALPN option when one is set
+func (o *TLSOptions) Config(alpn []string) (*tls.Config, error) {
+	conf := &tls.Config{
+		// No certificate verification
+		InsecureSkipVerify: true,
+		ServerName:         o.SNI,
+		NextProtos:         alpn,
+	}
+
+	if len(o.ALPN) > 0 {
+		conf.NextProtos = o.ALPN
+	}
+
+	if o.MinVersion != "" {
+		v, ok := tlsVersionIDs[o.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS version %s", o.MinVersion)
+		}
+		conf.MinVersion = v
+	}
+
+	if o.MaxVersion != "" {
+		v, ok := tlsVersionIDs[o.MaxVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS version %s", o.MaxVersion)
+		}
+		conf.MaxVersion = v
+	}
+
+	if len(o.Ciphers) > 0 {
+		suites := make(map[string]uint16)
+		for _, s := range tls.CipherSuites() {
+			suites[s.Name] = s.ID
+		}
+		for _, s := range tls.InsecureCipherSuites() {
+			suites[s.Name] = s.ID
+		}
+
+		for _, name := range o.Ciphers {
+			id, ok := suites[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown cipher suite %s", name)
+			}
+			conf.CipherSuites = append(conf.CipherSuites, id)
+		}
+	}
+
+	if o.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(o.ClientCert, o.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	return conf, nil
+}
+
+// dialTLS - open a TLS connection to the destination using the request's TLS options.
+// The negotiated parameters are stored in r.TLSState
+func (r *Request) dialTLS(port int, alpn []string) (*tls.Conn, error) {
+	conf, err := r.TLSOptions.Config(alpn)
+	if err != nil {
+		return nil, err
+	}
+
+	// the hostname may be dialled by a different IP, so it's set for SNI explicitly
+	if conf.ServerName == "" {
+		conf.ServerName = r.Host
+	}
+
+	conn, err := r.dialTCP(port)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConn := tls.Client(conn, conf)
+	tlsConn.SetDeadline(time.Now().Add(30 * time.Second))
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	tlsConn.SetDeadline(time.Time{})
+
+	cs := tlsConn.ConnectionState()
+	r.TLSState = newTLSState(cs)
+	if dialer.Verify != nil {
+		r.TLSState.Verify = "ok"
+		// the certificate should be for the name that was asked for, the SNI override if there is one
+		if err := dialer.Verify.Check(cs, conf.ServerName); err != nil {
+			r.TLSState.Verify = err.Error()
+		}
+	}
+
+	return tlsConn, nil
+}
+
+func newTLSState(cs tls.ConnectionState) *TLSState {
+	state := &TLSState{
+		Version:     tls.VersionName(cs.Version),
+		CipherSuite: tls.CipherSuiteName(cs.CipherSuite),
+		ALPN:        cs.NegotiatedProtocol,
+		ServerName:  cs.ServerName,
+	}
+
+	for _, cert := range cs.PeerCertificates {
+		sum := sha256.Sum256(cert.Raw)
+		state.Chain = append(state.Chain, TLSCertificate{
+			Subject:   cert.Subject.String(),
+			Issuer:    cert.Issuer.String(),
+			NotBefore: cert.NotBefore,
+			NotAfter:  cert.NotAfter,
+			DNSNames:  cert.DNSNames,
+			SHA256:    hex.EncodeToString(sum[:]),
+		})
+	}
+
+	return state
+}
+
+// String - the negotiated parameters followed by the certificate chain
+func (s *TLSState) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Version: %s\nCipher:  %s\nALPN:    %s\nSNI:     %s\n", s.Version, s.CipherSuite, s.ALPN, s.ServerName)
+	if s.Verify != "" {
+		fmt.Fprintf(&b, "Verify:  %s\n", s.Verify)
+	}
+	for i, cert := range s.Chain {
+		fmt.Fprintf(&b, "\n[%d] %s\n", i, cert.Subject)
+		fmt.Fprintf(&b, "    Issuer:  %s\n", cert.Issuer)
+		fmt.Fprintf(&b, "    Valid:   %s - %s\n", cert.NotBefore.Format(time.RFC3339), cert.NotAfter.Format(time.RFC3339))
+		if len(cert.DNSNames) > 0 {
+			fmt.Fprintf(&b, "    DNS:     %s\n", strings.Join(cert.DNSNames, ", "))
+		}
+		fmt.Fprintf(&b, "    SHA256:  %s\n", cert.SHA256)
+	}
+
+	return b.String()
+}
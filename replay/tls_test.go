@@ -0,0 +1,41 @@
+package replay
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestTLSOptionsConfig(t *testing.T) {
+	opts := TLSOptions{
+		SNI:        "other.example",
+		MinVersion: "1.2",
+		MaxVersion: "1.2",
+		Ciphers:    []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+	}
+
+	conf, err := opts.Config([]string{"h2"})
+	if err != nil {
+		t.Fatalf("TestTLSOptionsConfig unexpected error: %v", err)
+	}
+
+	if conf.ServerName != "other.example" {
+		t.Errorf("TestTLSOptionsConfig unexpected SNI: got %v want %v", conf.ServerName, "other.example")
+	}
+
+	if conf.MinVersion != tls.VersionTLS12 || conf.MaxVersion != tls.VersionTLS12 {
+		t.Errorf("TestTLSOptionsConfig unexpected versions: got %x-%x want %x", conf.MinVersion, conf.MaxVersion, tls.VersionTLS12)
+	}
+
+	if len(conf.CipherSuites) != 1 || conf.CipherSuites[0] != tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("TestTLSOptionsConfig unexpected ciphers: got %v", conf.CipherSuites)
+	}
+
+	if len(conf.NextProtos) != 1 || conf.NextProtos[0] != "h2" {
+		t.Errorf("TestTLSOptionsConfig unexpected ALPN: got %v want %v", conf.NextProtos, []string{"h2"})
+	}
+
+	opts.Ciphers = []string{"NOT_A_CIPHER"}
+	if _, err := opts.Config(nil); err == nil {
+		t.Errorf("TestTLSOptionsConfig expected an error for an unknown cipher")
+	}
+}
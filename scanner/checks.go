@@ -0,0 +1,378 @@
+package scanner
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/denandz/glorp/modifier"
+)
+
+// DefaultChecks - the checks new scanners run
+var DefaultChecks = []Check{
+	{"Security headers", securityHeaders},
+	{"Cookies", cookies},
+	{"Banners", banners},
+	{"Error messages", errorMessages},
+	{"Mixed content", mixedContent},
+	{"Caching", caching},
+	{"Credentials over HTTP", credentials},
+}
+
+// securityHeaders - missing and weak HSTS, CSP, clickjacking and content sniffing headers
+func securityHeaders(m *Message) []Issue {
+	var issues []Issue
+	h := m.Response.Header
+
+	if m.URL.Scheme == "https" {
+		hsts := h.Get("Strict-Transport-Security")
+		if hsts == "" {
+			issues = append(issues, Issue{
+				Finding: modifier.Finding{Name: "Missing Strict-Transport-Security header", Severity: modifier.SeverityLow,
+					Detail: "The host doesn't tell browsers to only use HTTPS, so a first visit over HTTP can be intercepted."},
+				Path: "/",
+			})
+		} else if age := maxAge(hsts); age < 180*24*60*60 {
+			issues = append(issues, Issue{
+				Finding: modifier.Finding{Name: "Weak Strict-Transport-Security header", Severity: modifier.SeverityInfo,
+					Detail: "The HSTS max-age is " + strconv.Itoa(age) + " seconds, less than six months."},
+				Path:     "/",
+				Location: LocationResponse,
+				Evidence: []string{hsts},
+			})
+		}
+	}
+
+	if !m.HTML() || m.Response.StatusCode < 200 || m.Response.StatusCode > 299 {
+		return issues
+	}
+
+	csp := h.Get("Content-Security-Policy")
+	if csp == "" {
+		issues = append(issues, Issue{
+			Finding: modifier.Finding{Name: "Missing Content-Security-Policy header", Severity: modifier.SeverityLow,
+				Detail: "The page has no Content-Security-Policy to limit the damage of cross-site scripting."},
+		})
+	} else if weak := weakCSP(csp); len(weak) > 0 {
+		issues = append(issues, Issue{
+			Finding: modifier.Finding{Name: "Weak Content-Security-Policy header", Severity: modifier.SeverityInfo,
+				Detail: "The policy allows " + strings.Join(weak, ", ") + " for scripts."},
+			Location: LocationResponse,
+			Evidence: weak,
+		})
+	}
+
+	if h.Get("X-Frame-Options") == "" && !strings.Contains(strings.ToLower(csp), "frame-ancestors") {
+		issues = append(issues, Issue{
+			Finding: modifier.Finding{Name: "Missing clickjacking protection", Severity: modifier.SeverityLow,
+				Detail: "The page sets neither X-Frame-Options nor a CSP frame-ancestors directive, so other sites can frame it."},
+		})
+	}
+
+	if !strings.EqualFold(h.Get("X-Content-Type-Options"), "nosniff") {
+		issues = append(issues, Issue{
+			Finding: modifier.Finding{Name: "Missing X-Content-Type-Options header", Severity: modifier.SeverityInfo,
+				Detail: "Without nosniff, browsers may guess a different content type for the response."},
+		})
+	}
+
+	return issues
+}
+
+var maxAgeRe = regexp.MustCompile(`(?i)max-age\s*=\s*"?(\d+)`)
+
+func maxAge(hsts string) int {
+	if m := maxAgeRe.FindStringSubmatch(hsts); m != nil {
+		age, _ := strconv.Atoi(m[1])
+		return age
+	}
+	return 0
+}
+
+// weakCSP - the unsafe sources a policy allows scripts from
+func weakCSP(csp string) []string {
+	var weak []string
+	for _, directive := range strings.Split(csp, ";") {
+		fields := strings.Fields(directive)
+		if len(fields) == 0 || (fields[0] != "script-src" && fields[0] != "default-src") {
+			continue
+		}
+		for _, src := range fields[1:] {
+			if (src == "'unsafe-inline'" || src == "'unsafe-eval'" || src == "*") && !contains(weak, src) {
+				weak = append(weak, src)
+			}
+		}
+	}
+	return weak
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// cookies - cookies set without the Secure, HttpOnly or SameSite attributes
+func cookies(m *Message) []Issue {
+	var noSecure, noHTTPOnly, noSameSite []string
+	var noSecureNames, noHTTPOnlyNames, noSameSiteNames []string
+
+	for _, line := range m.Response.Header.Values("Set-Cookie") {
+		c, err := http.ParseSetCookie(line)
+		if err != nil {
+			continue
+		}
+		// cookies being cleared don't matter
+		if c.MaxAge < 0 || c.Value == "" {
+			continue
+		}
+
+		if !c.Secure && m.URL.Scheme == "https" {
+			noSecure, noSecureNames = append(noSecure, line), append(noSecureNames, c.Name)
+		}
+		if !c.HttpOnly {
+			noHTTPOnly, noHTTPOnlyNames = append(noHTTPOnly, line), append(noHTTPOnlyNames, c.Name)
+		}
+		if c.SameSite == 0 {
+			noSameSite, noSameSiteNames = append(noSameSite, line), append(noSameSiteNames, c.Name)
+		}
+	}
+
+	var issues []Issue
+	add := func(name, severity, detail string, evidence, names []string) {
+		if len(evidence) > 0 {
+			issues = append(issues, Issue{
+				Finding:  modifier.Finding{Name: name, Severity: severity, Detail: detail + strings.Join(names, ", ")},
+				Location: LocationResponse,
+				Evidence: evidence,
+			})
+		}
+	}
+	add("Cookie without Secure flag", modifier.SeverityLow, "These cookies can be sent over plain HTTP: ", noSecure, noSecureNames)
+	add("Cookie without HttpOnly flag", modifier.SeverityLow, "These cookies can be read by scripts: ", noHTTPOnly, noHTTPOnlyNames)
+	add("Cookie without SameSite attribute", modifier.SeverityInfo, "These cookies rely on the browser's default SameSite behaviour: ", noSameSite, noSameSiteNames)
+
+	return issues
+}
+
+var versionRe = regexp.MustCompile(`\d+\.\d+`)
+
+// banners - headers giving away server software and versions
+func banners(m *Message) []Issue {
+	var evidence, headers []string
+
+	if server := m.Response.Header.Get("Server"); versionRe.MatchString(server) {
+		evidence, headers = append(evidence, server), append(headers, "Server")
+	}
+	for _, name := range []string{"X-Powered-By", "X-AspNet-Version", "X-AspNetMvc-Version", "X-Generator"} {
+		if v := m.Response.Header.Get(name); v != "" {
+			evidence, headers = append(evidence, v), append(headers, name)
+		}
+	}
+
+	if len(evidence) == 0 {
+		return nil
+	}
+	return []Issue{{
+		Finding: modifier.Finding{Name: "Verbose server banner", Severity: modifier.SeverityLow,
+			Detail: "Software details are disclosed in the " + strings.Join(headers, ", ") + " headers."},
+		Path:     "/",
+		Location: LocationResponse,
+		Evidence: evidence,
+	}}
+}
+
+var stackTraceRes = []*regexp.Regexp{
+	regexp.MustCompile(`\bat [\w$.]+\([\w$]+\.java:\d+\)`),                       // Java
+	regexp.MustCompile(`\bat [\w.` + "`" + `<>]+\(.*\) in .+:line \d+`),          // .NET
+	regexp.MustCompile(`Traceback \(most recent call last\):`),                   // Python
+	regexp.MustCompile(`goroutine \d+ \[running\]:`),                             // Go
+	regexp.MustCompile(`\bat [\w.<>]+ \((?:/|[A-Za-z]:\\)[^)\s]+\.js:\d+:\d+\)`), // Node
+	regexp.MustCompile(`[\w/.-]+\.rb:\d+:in ` + "`"),                             // Ruby
+	regexp.MustCompile(`(?i)(?:fatal error|parse error|warning)(?:</b>)?:\s.{1,300}? in (?:<b>)?[\w/\\.-]+\.php(?:</b>)? on line`),
+}
+
+var sqlErrorRes = []*regexp.Regexp{
+	regexp.MustCompile(`You have an error in your SQL syntax`),
+	regexp.MustCompile(`\bmysqli?_\w+\(\)`),
+	regexp.MustCompile(`PG::[A-Z]\w+Error`),
+	regexp.MustCompile(`ERROR:\s+syntax error at or near`),
+	regexp.MustCompile(`org\.postgresql\.util\.PSQLException`),
+	regexp.MustCompile(`Unclosed quotation mark after the character string`),
+	regexp.MustCompile(`Microsoft OLE DB Provider for (?:SQL Server|ODBC Drivers)`),
+	regexp.MustCompile(`\bORA-\d{5}:`),
+	regexp.MustCompile(`sqlite3\.OperationalError|SQLITE_ERROR`),
+	regexp.MustCompile(`SQLSTATE\[\w+\]`),
+}
+
+// errorMessages - stack traces and database errors in responses
+func errorMessages(m *Message) []Issue {
+	var issues []Issue
+
+	if evidence := findAll(stackTraceRes, m.Body); len(evidence) > 0 {
+		issues = append(issues, Issue{
+			Finding: modifier.Finding{Name: "Stack trace in response", Severity: modifier.SeverityLow,
+				Detail: "The response includes a stack trace, which gives away code paths and libraries."},
+			Location: LocationResponse,
+			Evidence: evidence,
+		})
+	}
+
+	if evidence := findAll(sqlErrorRes, m.Body); len(evidence) > 0 {
+		issues = append(issues, Issue{
+			Finding: modifier.Finding{Name: "SQL error in response", Severity: modifier.SeverityMedium,
+				Detail: "The response includes a database error message, which can point to SQL injection."},
+			Location: LocationResponse,
+			Evidence: evidence,
+		})
+	}
+
+	return issues
+}
+
+// findAll - the distinct text res match in body, up to five pieces
+func findAll(res []*regexp.Regexp, body []byte) []string {
+	var found []string
+	for _, re := range res {
+		for _, match := range re.FindAll(body, 5) {
+			if s := string(match); !contains(found, s) && len(found) < 5 {
+				found = append(found, s)
+			}
+		}
+	}
+	return found
+}
+
+var mixedContentRe = regexp.MustCompile(`(?i)<(script|iframe|frame|object|embed|link|form|img|audio|video|source)\b[^>]*?\b(?:src|href|action|data)\s*=\s*["']?(http://[^"'\s>]+)`)
+
+// mixedContent - HTTPS pages loading resources over plain HTTP
+func mixedContent(m *Message) []Issue {
+	if m.URL.Scheme != "https" || !m.HTML() {
+		return nil
+	}
+
+	var evidence []string
+	severity := modifier.SeverityLow
+	for _, match := range mixedContentRe.FindAllSubmatch(m.Body, 20) {
+		switch strings.ToLower(string(match[1])) {
+		case "img", "audio", "video", "source":
+		default:
+			// active content can change the page, not just how it looks
+			severity = modifier.SeverityMedium
+		}
+		if s := string(match[2]); !contains(evidence, s) {
+			evidence = append(evidence, s)
+		}
+	}
+
+	if len(evidence) == 0 {
+		return nil
+	}
+	return []Issue{{
+		Finding: modifier.Finding{Name: "Mixed content", Severity: severity,
+			Detail: "The HTTPS page loads resources over plain HTTP, which can be read and changed in transit."},
+		Location: LocationResponse,
+		Evidence: evidence,
+	}}
+}
+
+// caching - responses to authenticated requests, or setting cookies, that caches may keep
+func caching(m *Message) []Issue {
+	if m.Response.StatusCode != http.StatusOK {
+		return nil
+	}
+
+	sensitive := m.Request.Header.Get("Authorization") != "" ||
+		m.Request.Header.Get("Cookie") != "" ||
+		len(m.Response.Header.Values("Set-Cookie")) > 0
+	if !sensitive {
+		return nil
+	}
+
+	cc := strings.ToLower(m.Response.Header.Get("Cache-Control"))
+	if strings.Contains(cc, "no-store") || strings.Contains(cc, "private") {
+		return nil
+	}
+
+	is := Issue{
+		Finding: modifier.Finding{Name: "Cacheable sensitive response", Severity: modifier.SeverityLow,
+			Detail: "The response is to an authenticated request or sets cookies, but doesn't stop shared caches keeping it with Cache-Control: no-store or private."},
+	}
+	if cc != "" {
+		is.Location, is.Evidence = LocationResponse, []string{m.Response.Header.Get("Cache-Control")}
+	}
+	return []Issue{is}
+}
+
+var (
+	passwordParamRe = regexp.MustCompile(`(?i)^(?:password|passwd|pwd|pass|passphrase|secret)$`)
+	passwordJSONRe  = regexp.MustCompile(`(?i)"(?:password|passwd|pwd|passphrase|secret)"\s*:`)
+	passwordInputRe = regexp.MustCompile(`(?i)<input\b[^>]*\btype\s*=\s*["']?password`)
+)
+
+// credentials - passwords and authorization headers sent over plain HTTP, and login forms served over it
+func credentials(m *Message) []Issue {
+	if m.URL.Scheme != "http" {
+		return nil
+	}
+
+	var issues []Issue
+
+	if auth := m.Request.Header.Get("Authorization"); auth != "" {
+		is := Issue{
+			Finding: modifier.Finding{Name: "Authorization header sent over HTTP", Severity: modifier.SeverityMedium,
+				Detail: "Credentials in the Authorization header can be read in transit."},
+			Location: LocationRequest,
+			Evidence: []string{auth},
+		}
+		if scheme, _, _ := strings.Cut(auth, " "); strings.EqualFold(scheme, "Basic") {
+			is.Severity = modifier.SeverityHigh
+			is.Detail = "Basic authentication sends the username and password in the clear."
+		}
+		issues = append(issues, is)
+	}
+
+	var evidence []string
+	params := m.URL.Query()
+	if ct := m.Request.Header.Get("Content-Type"); strings.HasPrefix(ct, "application/x-www-form-urlencoded") {
+		if form, err := url.ParseQuery(string(m.RequestBody)); err == nil {
+			for k, v := range form {
+				params[k] = append(params[k], v...)
+			}
+		}
+	}
+	for k := range params {
+		if passwordParamRe.MatchString(k) {
+			evidence = append(evidence, k+"=")
+		}
+	}
+	if match := passwordJSONRe.Find(m.RequestBody); match != nil {
+		evidence = append(evidence, string(match))
+	}
+	if len(evidence) > 0 {
+		issues = append(issues, Issue{
+			Finding: modifier.Finding{Name: "Password sent over HTTP", Severity: modifier.SeverityHigh,
+				Detail: "The request sends a password in the clear."},
+			Location: LocationRequest,
+			Evidence: evidence,
+		})
+	}
+
+	if m.HTML() {
+		if match := passwordInputRe.Find(m.Body); match != nil {
+			issues = append(issues, Issue{
+				Finding: modifier.Finding{Name: "Password field served over HTTP", Severity: modifier.SeverityMedium,
+					Detail: "The page asks for a password but can be changed in transit to send it elsewhere."},
+				Location: LocationResponse,
+				Evidence: []string{string(match)},
+			})
+		}
+	}
+
+	return issues
+}
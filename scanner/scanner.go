@@ -0,0 +1,338 @@
+// Package scanner runs passive security checks over proxy entries as their responses
+// arrive, and keeps the issues they find de-duplicated by host and path.
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/denandz/glorp/modifier"
+
+	"github.com/google/martian/v3/messageview"
+)
+
+// Where an issue's evidence is found
+const (
+	LocationRequest  = "request"
+	LocationResponse = "response"
+)
+
+// maxEntries - how many entry IDs an issue keeps
+const maxEntries = 10
+
+// Issue - a problem found by a check, merged with the same problem on the same host and path
+type Issue struct {
+	modifier.Finding
+	// ID identifies the issue by its name, host and path.
+	ID   string `json:"id"`
+	Host string `json:"host"`
+	// Path is the URL path the issue was found on, / for issues about the whole host.
+	Path string `json:"path"`
+	// Location is the message Evidence is found in, request or response.
+	Location string `json:"location,omitempty"`
+	// Evidence is the text in the message that shows the problem, if there is any.
+	Evidence []string `json:"evidence,omitempty"`
+	// Entries are the IDs of the first entries the issue was found in.
+	Entries []string `json:"entries"`
+	// Count is how many entries the issue was found in.
+	Count int `json:"count"`
+	// First is when the issue was first found.
+	First time.Time `json:"first"`
+}
+
+// Message - the parts of an entry the checks look at, parsed once per entry
+type Message struct {
+	Entry       *modifier.Entry
+	URL         *url.URL
+	Request     *http.Request
+	RequestBody []byte
+	Response    *http.Response
+	Body        []byte // the response body, decoded
+}
+
+// ContentType - the response's media type, lower case and without parameters
+func (m *Message) ContentType() string {
+	mt, _, _ := mime.ParseMediaType(m.Response.Header.Get("Content-Type"))
+	return mt
+}
+
+// HTML - whether the response is an HTML page
+func (m *Message) HTML() bool {
+	return m.ContentType() == "text/html"
+}
+
+// Check - a passive check. Run returns the issues found in a message, leaving Host,
+// Entries and the rest for the scanner to fill in. Path is the message's path unless Run
+// sets it, such as to / for issues about the whole host
+type Check struct {
+	Name string
+	Run  func(m *Message) []Issue
+}
+
+// Scanner - runs the checks over entries in the background, and keeps the issues found
+type Scanner struct {
+	mu     sync.Mutex
+	issues map[string]*Issue
+	checks []Check
+	queue  chan *modifier.Entry
+	notify chan string // IDs of issues found or updated
+}
+
+// New - a scanner running DefaultChecks, notify gets the ID of each issue found or updated
+func New(notify chan string) *Scanner {
+	s := &Scanner{
+		issues: make(map[string]*Issue),
+		checks: slices.Clone(DefaultChecks),
+		queue:  make(chan *modifier.Entry, 1024),
+		notify: notify,
+	}
+	go s.run()
+	return s
+}
+
+// Register - add a check to the ones the scanner runs
+func (s *Scanner) Register(c Check) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checks = append(s.checks, c)
+}
+
+// Submit - queue an entry with a response to be scanned. Entries are dropped, with a
+// log message, when the scanner can't keep up
+func (s *Scanner) Submit(e *modifier.Entry) {
+	select {
+	case s.queue <- e:
+	default:
+		log.Printf("[!] Scanner - queue full, skipping %s\n", e.ID)
+	}
+}
+
+func (s *Scanner) run() {
+	for e := range s.queue {
+		s.Scan(e)
+	}
+}
+
+// Scan - run the checks over an entry now. Blocked and tunnel entries, and entries
+// without a response, are skipped
+func (s *Scanner) Scan(e *modifier.Entry) {
+	if e.Request == nil || e.Response == nil || e.Blocked || e.Source == modifier.SourceTunnel {
+		return
+	}
+
+	m, err := newMessage(e)
+	if err != nil {
+		log.Printf("[!] Scanner - %s: %s\n", e.ID, err)
+		return
+	}
+
+	s.mu.Lock()
+	checks := s.checks
+	s.mu.Unlock()
+
+	for _, c := range checks {
+		for _, is := range c.Run(m) {
+			s.add(m, is)
+		}
+	}
+}
+
+// add - record an issue found in m, merging it with the issue for the same host and path
+func (s *Scanner) add(m *Message, is Issue) {
+	is.Host = m.URL.Hostname()
+	if is.Path == "" {
+		is.Path = m.URL.Path
+	}
+	if is.Path == "" {
+		is.Path = "/"
+	}
+	is.ID = issueID(is.Name, is.Host, is.Path)
+
+	s.mu.Lock()
+	if old, ok := s.issues[is.ID]; ok {
+		old.Count++
+		if len(old.Entries) < maxEntries {
+			old.Entries = append(old.Entries, m.Entry.ID)
+		}
+	} else {
+		is.Entries = []string{m.Entry.ID}
+		is.Count = 1
+		is.First = time.Now().UTC()
+		s.issues[is.ID] = &is
+	}
+	s.mu.Unlock()
+
+	if s.notify != nil {
+		s.notify <- is.ID
+	}
+}
+
+func issueID(name, host, path string) string {
+	sum := sha256.Sum256([]byte(name + "\x00" + host + "\x00" + path))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Get - a copy of the issue with id, nil if there isn't one
+func (s *Scanner) Get(id string) *Issue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	is, ok := s.issues[id]
+	if !ok {
+		return nil
+	}
+	c := *is
+	c.Entries = slices.Clone(is.Entries)
+	return &c
+}
+
+// Issues - a copy of every issue, most severe first, then by host and path
+func (s *Scanner) Issues() []Issue {
+	s.mu.Lock()
+	issues := make([]Issue, 0, len(s.issues))
+	for _, is := range s.issues {
+		c := *is
+		c.Entries = slices.Clone(is.Entries)
+		issues = append(issues, c)
+	}
+	s.mu.Unlock()
+
+	slices.SortFunc(issues, func(a, b Issue) int {
+		if d := severityRank(a.Severity) - severityRank(b.Severity); d != 0 {
+			return d
+		}
+		return strings.Compare(a.Host+a.Path+a.Name, b.Host+b.Path+b.Name)
+	})
+	return issues
+}
+
+func severityRank(severity string) int {
+	switch severity {
+	case modifier.SeverityHigh:
+		return 0
+	case modifier.SeverityMedium:
+		return 1
+	case modifier.SeverityLow:
+		return 2
+	}
+	return 3
+}
+
+// Remove - forget the issue with id, it's found again if it shows up in a new entry
+func (s *Scanner) Remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.issues, id)
+}
+
+// Load - replace the issues with ones from a save file
+func (s *Scanner) Load(issues []Issue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.issues = make(map[string]*Issue)
+	for i := range issues {
+		is := issues[i]
+		if is.ID == "" {
+			is.ID = issueID(is.Name, is.Host, is.Path)
+		}
+		s.issues[is.ID] = &is
+	}
+}
+
+// Reset - drop the issues and the entries still waiting to be scanned, such as when the
+// log they came from is cleared
+func (s *Scanner) Reset() {
+	for len(s.queue) > 0 {
+		select {
+		case <-s.queue:
+		default:
+		}
+	}
+	s.Load(nil)
+}
+
+// newMessage - parse an entry's raw request and response
+func newMessage(e *modifier.Entry) (*Message, error) {
+	u, err := url.Parse(e.Request.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(e.Request.Raw)))
+	if err != nil {
+		return nil, err
+	}
+	// the body may be short of its length when it was spilled to disk, what's there is enough
+	reqBody, _ := io.ReadAll(req.Body)
+
+	res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(e.Response.Raw)), req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		Entry:       e,
+		URL:         u,
+		Request:     req,
+		RequestBody: reqBody,
+		Response:    res,
+		Body:        decodeBody(e.Response.Raw, res),
+	}, nil
+}
+
+// decodeBody - the response body with its content encoding removed, or as it is in raw
+// when it can't be decoded
+func decodeBody(raw []byte, res *http.Response) []byte {
+	mv := messageview.New()
+	if err := mv.SnapshotResponse(res); err == nil {
+		if br, err := mv.BodyReader(messageview.Decode()); err == nil {
+			if body, err := io.ReadAll(br); err == nil {
+				return body
+			}
+		}
+	}
+
+	if i := bytes.Index(raw, []byte("\r\n\r\n")); i != -1 {
+		return raw[i+4:]
+	}
+	return nil
+}
+
+// Text - an entry's request, or its response with the body decoded, as the checks saw it.
+// location is LocationRequest or LocationResponse
+func Text(e *modifier.Entry, location string) string {
+	if location == LocationRequest {
+		if e.Request == nil {
+			return ""
+		}
+		return string(e.Request.Raw)
+	}
+
+	if e.Response == nil {
+		return ""
+	}
+	m, err := newMessage(e)
+	if err != nil {
+		return string(e.Response.Raw)
+	}
+
+	head := e.Response.Raw
+	if i := bytes.Index(head, []byte("\r\n\r\n")); i != -1 {
+		head = head[:i+4]
+	}
+	return string(head) + string(m.Body)
+}
@@ -0,0 +1,87 @@
+package scanner
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/denandz/glorp/modifier"
+)
+
+func entry(id, url, req, res string) *modifier.Entry {
+	return &modifier.Entry{
+		ID:       id,
+		Request:  &modifier.Request{URL: url, Raw: []byte(req)},
+		Response: &modifier.Response{Raw: []byte(res)},
+	}
+}
+
+func TestCookies(t *testing.T) {
+	e := entry("1", "https://example.com/login",
+		"GET /login HTTP/1.1\r\nHost: example.com\r\n\r\n",
+		"HTTP/1.1 302 Found\r\nSet-Cookie: session=abc; Path=/; HttpOnly; SameSite=Lax\r\nSet-Cookie: theme=dark; Path=/\r\nSet-Cookie: old=; Max-Age=0\r\nContent-Length: 0\r\n\r\n")
+
+	m, err := newMessage(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]string{}
+	for _, is := range cookies(m) {
+		got[is.Name] = is.Detail
+	}
+
+	want := map[string]string{
+		"Cookie without Secure flag":        "session, theme",
+		"Cookie without HttpOnly flag":      "theme",
+		"Cookie without SameSite attribute": "theme",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("TestCookies got %v want %v", got, want)
+	}
+	for name, names := range want {
+		if !strings.HasSuffix(got[name], names) {
+			t.Errorf("TestCookies %s got %q want it to end in %q", name, got[name], names)
+		}
+	}
+}
+
+func TestScanDedupe(t *testing.T) {
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte("<html>ERROR: You have an error in your SQL syntax near ''' at line 1</html>"))
+	w.Close()
+
+	s := &Scanner{issues: make(map[string]*Issue), checks: DefaultChecks}
+	for _, id := range []string{"1", "2"} {
+		s.Scan(entry(id, "http://example.com/search?q=%27",
+			"GET /search?q=%27 HTTP/1.1\r\nHost: example.com\r\n\r\n",
+			"HTTP/1.1 500 Internal Server Error\r\nServer: Apache/2.4.1\r\nContent-Type: text/html\r\nContent-Encoding: gzip\r\nContent-Length: "+
+				strconv.Itoa(gz.Len())+"\r\n\r\n"+gz.String()))
+	}
+
+	var sql, banner *Issue
+	for _, is := range s.Issues() {
+		switch is.Name {
+		case "SQL error in response":
+			sql = &is
+		case "Verbose server banner":
+			banner = &is
+		}
+	}
+
+	if sql == nil || banner == nil {
+		t.Fatalf("TestScanDedupe got %v", s.Issues())
+	}
+	if sql.Count != 2 || len(sql.Entries) != 2 || sql.Path != "/search" {
+		t.Errorf("TestScanDedupe SQL error got count %d entries %v path %s want 2 [1 2] /search", sql.Count, sql.Entries, sql.Path)
+	}
+	if len(sql.Evidence) != 1 || sql.Evidence[0] != "You have an error in your SQL syntax" {
+		t.Errorf("TestScanDedupe SQL error evidence got %v", sql.Evidence)
+	}
+	if banner.Path != "/" || banner.Severity != modifier.SeverityLow {
+		t.Errorf("TestScanDedupe banner got path %s severity %s want / Low", banner.Path, banner.Severity)
+	}
+}
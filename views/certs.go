@@ -0,0 +1,92 @@
+package views
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/denandz/glorp/modifier"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// chainPEM - the entry's upstream certificate chain, PEM encoded
+func chainPEM(entry *modifier.Entry) []byte {
+	var b []byte
+	if entry.Conn == nil {
+		return b
+	}
+
+	for _, der := range entry.Conn.Certificates {
+		b = append(b, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	return b
+}
+
+// connSummary - the entry's findings followed by its upstream certificate chain
+func connSummary(entry *modifier.Entry) string {
+	var b strings.Builder
+
+	for _, f := range entry.Findings {
+		fmt.Fprintf(&b, "[%s] %s\n", f.Severity, f.Name)
+		if f.Detail != "" {
+			fmt.Fprintf(&b, "    %s\n", f.Detail)
+		}
+	}
+
+	if entry.Conn == nil || len(entry.Conn.Certificates) == 0 {
+		if b.Len() == 0 {
+			b.WriteString("No upstream certificates recorded\n")
+		}
+		return b.String()
+	}
+
+	for i, der := range entry.Conn.Certificates {
+		sum := sha256.Sum256(der)
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			fmt.Fprintf(&b, "\n[%d] unparseable certificate: %s\n", i, err)
+			continue
+		}
+
+		fmt.Fprintf(&b, "\n[%d] %s\n", i, cert.Subject)
+		fmt.Fprintf(&b, "    Issuer:  %s\n", cert.Issuer)
+		fmt.Fprintf(&b, "    Valid:   %s - %s\n", cert.NotBefore.Format(time.RFC3339), cert.NotAfter.Format(time.RFC3339))
+		if len(cert.DNSNames) > 0 {
+			fmt.Fprintf(&b, "    DNS:     %s\n", strings.Join(cert.DNSNames, ", "))
+		}
+		fmt.Fprintf(&b, "    SHA256:  %s\n", hex.EncodeToString(sum[:]))
+	}
+
+	return b.String()
+}
+
+// certModal - show the entry's findings and upstream certificate chain
+func certModal(app *tview.Application, page *tview.Pages, back tview.Primitive, entry *modifier.Entry) {
+	text := tview.NewTextView()
+	text.SetBorder(true)
+	text.SetTitle("Certificates - " + entry.ID)
+	text.SetText(connSummary(entry))
+
+	closeModal := func() {
+		page.HidePage("certmodal")
+		page.RemovePage("certmodal")
+		app.SetFocus(back)
+	}
+
+	text.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyESC || event.Key() == tcell.KeyEnter {
+			closeModal()
+			return nil
+		}
+		return event
+	})
+
+	page.AddPage("certmodal", newmodal(text, 100, 24), true, true)
+	app.SetFocus(text)
+}
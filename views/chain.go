@@ -0,0 +1,187 @@
+package views
+
+import (
+	"container/ring"
+	"log"
+
+	"github.com/denandz/glorp/replay"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// chainModal - show the chain editor. Chains are written as "step <replay id>" lines,
+// each optionally followed by "extract <name> <regex>" lines. Extracted values
+// are substituted into later steps wherever {{name}} appears
+func (view *ReplayView) chainModal(app *tview.Application) {
+	nameInput := tview.NewInputField()
+	nameInput.SetLabel("Name ")
+	nameInput.SetLabelColor(tcell.ColorMediumPurple)
+
+	definition := tview.NewTextArea()
+	definition.SetBorder(true)
+	definition.SetTitle("Steps")
+
+	if c, ok := view.chains[view.chain]; ok {
+		nameInput.SetText(c.Name)
+		definition.SetText(c.String(), false)
+	} else {
+		nameInput.SetText("chain")
+		definition.SetText("step "+view.id+"\n", true)
+	}
+
+	// load an existing chain when its name is entered
+	nameInput.SetDoneFunc(func(key tcell.Key) {
+		if c, ok := view.chains[nameInput.GetText()]; ok {
+			definition.SetText(c.String(), false)
+		}
+	})
+
+	modal := tview.NewFlex()
+	closeModal := func() {
+		view.Layout.HidePage("chainmodal")
+		view.Layout.RemovePage("chainmodal")
+		app.SetFocus(view.Table)
+	}
+
+	save := func() *replay.Chain {
+		c, err := replay.ParseChain(nameInput.GetText(), definition.GetText())
+		if err != nil {
+			modal.SetTitle("Chain - " + err.Error())
+			return nil
+		}
+		view.chains[c.Name] = c
+		view.chain = c.Name
+		return c
+	}
+
+	saveButton := tview.NewButton("Save").SetSelectedFunc(func() {
+		if save() != nil {
+			closeModal()
+		}
+	})
+	runButton := tview.NewButton("Run").SetSelectedFunc(func() {
+		if c := save(); c != nil {
+			closeModal()
+			view.runChain(app, c)
+		}
+	})
+	deleteButton := tview.NewButton("Delete").SetSelectedFunc(func() {
+		delete(view.chains, nameInput.GetText())
+		closeModal()
+	})
+
+	buttons := tview.NewFlex()
+	buttons.AddItem(saveButton, 0, 1, false).AddItem(runButton, 0, 1, false).AddItem(deleteButton, 0, 1, false)
+
+	modal.SetBorder(true)
+	modal.SetDirection(tview.FlexRow)
+	modal.SetTitle("Chain")
+	modal.AddItem(nameInput, 1, 1, true)
+	modal.AddItem(definition, 0, 1, false)
+	modal.AddItem(buttons, 1, 1, false)
+
+	items := []tview.Primitive{nameInput, definition, saveButton, runButton, deleteButton}
+	r := ring.New(len(items))
+	for i := range items {
+		r.Value = items[i]
+		r = r.Next()
+	}
+
+	modal.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyTab:
+			r = r.Next()
+			app.SetFocus(r.Value.(tview.Primitive))
+			return nil
+		case tcell.KeyBacktab:
+			r = r.Prev()
+			app.SetFocus(r.Value.(tview.Primitive))
+			return nil
+		case tcell.KeyESC:
+			closeModal()
+			return nil
+		}
+		return event
+	})
+
+	view.Layout.AddPage("chainmodal", newmodal(modal, 80, 20), true, false)
+	view.Layout.ShowPage("chainmodal")
+	app.SetFocus(nameInput)
+}
+
+// runChain - send each step of the chain in order. Every step is stored as a new
+// entry in its replay item's history. The chain stops on the first failed step
+func (view *ReplayView) runChain(app *tview.Application, c *replay.Chain) {
+	updateCL := view.updateContentLength.IsChecked()
+
+	go func() {
+		vars := make(map[string]string)
+		log.Printf("[+] ReplayView - runChain - Running chain %s (%d steps)\n", c.Name, len(c.Steps))
+
+		for i, step := range c.Steps {
+			rr, ok := view.replays[step.ID]
+			if !ok {
+				log.Printf("[!] ReplayView - runChain - Step %d: no replay item with ID %s\n", i+1, step.ID)
+				return
+			}
+
+			req := nextChainRequest(rr, vars, updateCL)
+			size, err := req.SendRequest()
+
+			if view.id == rr.ID {
+				view.refreshReplay(rr)
+				app.Draw()
+			}
+
+			if size == 0 {
+				log.Printf("[!] ReplayView - runChain - Step %d (%s) failed: %v\n", i+1, step.ID, err)
+				return
+			}
+
+			for _, rule := range step.Extract {
+				if v, ok := rule.Apply(req.RawResponse); ok {
+					vars[rule.Name] = v
+				} else {
+					log.Printf("[!] ReplayView - runChain - Step %d (%s): extract %s did not match\n", i+1, step.ID, rule.Name)
+				}
+			}
+		}
+
+		log.Printf("[+] ReplayView - runChain - Chain %s complete\n", c.Name)
+	}()
+}
+
+// nextChainRequest - get the request to send for a chain step. Variables are substituted
+// into the selected request's template, a new history entry is created if the selected
+// request already has a response
+func nextChainRequest(rr *ReplayRequests, vars map[string]string, updateCL bool) *replay.Request {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	current := rr.elements[rr.index]
+	template := current.Template
+	if template == nil {
+		template = current.RawRequest
+	}
+
+	req := current
+	if len(current.RawResponse) > 0 {
+		r := current.Copy()
+		r.RawResponse = nil
+		r.ResponseTime = ""
+		rr.elements = append(rr.elements, &r)
+		rr.index = len(rr.elements) - 1
+		req = &r
+	}
+
+	req.Template = make([]byte, len(template))
+	copy(req.Template, template)
+	req.RawRequest = replay.Substitute(req.Template, vars)
+
+	if updateCL {
+		req.UpdateContentLength()
+	}
+
+	return req
+}
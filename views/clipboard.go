@@ -0,0 +1,125 @@
+package views
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/rivo/tview"
+)
+
+// Clipboard - how copy actions reach the clipboard. "osc52" sends the data to the
+// terminal with the OSC 52 escape sequence, "file" writes it to a temp file instead
+var Clipboard = "osc52"
+
+// maxOSC52 - copies larger than this are written to a temp file, it keeps the base64
+// encoded sequence under the 100KB that many terminals silently drop sequences past
+const maxOSC52 = 74994
+
+// copyItem - an entry in the copy menu, data is only built when it's chosen
+type copyItem struct {
+	name string
+	data func() []byte
+}
+
+// osc52 - build the OSC 52 sequence that sets the clipboard. Inside tmux the sequence
+// is wrapped for passthrough, which needs tmux's allow-passthrough option
+func osc52(data []byte, tmux bool) string {
+	seq := "\x1b]52;c;" + base64.StdEncoding.EncodeToString(data) + "\x07"
+	if tmux {
+		seq = "\x1bPtmux;" + strings.ReplaceAll(seq, "\x1b", "\x1b\x1b") + "\x1b\\"
+	}
+	return seq
+}
+
+// copyToClipboard - put data on the clipboard, falling back to a temp file when
+// configured to or when there's too much data for OSC 52
+func copyToClipboard(app *tview.Application, page *tview.Pages, what string, data []byte) {
+	if Clipboard != "file" && len(data) <= maxOSC52 {
+		tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+		if err != nil {
+			tty = os.Stdout
+		} else {
+			defer tty.Close()
+		}
+
+		if _, err := fmt.Fprint(tty, osc52(data, os.Getenv("TMUX") != "")); err != nil {
+			log.Printf("[!] Clipboard - OSC 52 write failed: %s\n", err)
+		} else {
+			log.Printf("[+] Copied %s to the clipboard (%d bytes)\n", what, len(data))
+			return
+		}
+	}
+
+	file, err := os.CreateTemp(os.TempDir(), "glorp-copy")
+	if err != nil {
+		log.Printf("[!] Clipboard - %s\n", err)
+		return
+	}
+	defer file.Close()
+
+	if _, err := file.Write(data); err != nil {
+		log.Printf("[!] Clipboard - %s\n", err)
+		return
+	}
+
+	log.Printf("[+] Copied %s to %s (%d bytes)\n", what, file.Name(), len(data))
+	notifModal(app, page, "Copied to "+file.Name())
+}
+
+// copyModal - show the copy menu. The "Exported code" entry opens the export menu
+// and copies the chosen export, it's left out when r is nil
+func copyModal(app *tview.Application, page *tview.Pages, back tview.Primitive, items []copyItem, r *exportRequest) {
+	list := tview.NewList()
+	list.ShowSecondaryText(false)
+	list.SetBorder(true)
+	list.SetTitle("Copy")
+
+	closeModal := func() {
+		page.HidePage("copymodal")
+		page.RemovePage("copymodal")
+		app.SetFocus(back)
+	}
+
+	for _, item := range items {
+		list.AddItem(item.name, "", 0, func() {
+			closeModal()
+			copyToClipboard(app, page, item.name, item.data())
+		})
+	}
+
+	if r != nil {
+		list.AddItem("Exported code", "", 0, func() {
+			closeModal()
+			exportModal(app, page, back, r, func(title, out string) {
+				copyToClipboard(app, page, title, []byte(out))
+			})
+		})
+	}
+
+	list.SetDoneFunc(closeModal)
+
+	page.AddPage("copymodal", newmodal(list, 30, list.GetItemCount()+2), true, true)
+	app.SetFocus(list)
+}
+
+// messageBody - the body of a raw request or response
+func messageBody(raw []byte) []byte {
+	if _, body, found := bytes.Cut(raw, []byte("\r\n\r\n")); found {
+		return body
+	}
+	_, body, _ := bytes.Cut(raw, []byte("\n\n"))
+	return body
+}
+
+// messageHead - the start line and headers of a raw request or response
+func messageHead(raw []byte) []byte {
+	if head, _, found := bytes.Cut(raw, []byte("\r\n\r\n")); found {
+		return head
+	}
+	head, _, _ := bytes.Cut(raw, []byte("\n\n"))
+	return head
+}
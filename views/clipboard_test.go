@@ -0,0 +1,16 @@
+package views
+
+import (
+	"testing"
+)
+
+func TestOSC52(t *testing.T) {
+	if s := osc52([]byte("hi"), false); s != "\x1b]52;c;aGk=\x07" {
+		t.Errorf("TestOSC52 unexpected sequence: got %q want %q", s, "\x1b]52;c;aGk=\x07")
+	}
+
+	want := "\x1bPtmux;\x1b\x1b]52;c;aGk=\x07\x1b\\"
+	if s := osc52([]byte("hi"), true); s != want {
+		t.Errorf("TestOSC52 unexpected tmux sequence: got %q want %q", s, want)
+	}
+}
@@ -0,0 +1,151 @@
+package views
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/denandz/glorp/modifier"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// connColumn - an optional proxy table column showing a piece of connection metadata
+type connColumn struct {
+	name  string
+	value func(c *modifier.ConnInfo) string
+}
+
+// connColumns - the optional columns, shown after the fixed ones in this order
+var connColumns = []connColumn{
+	{"Client", func(c *modifier.ConnInfo) string { return c.ClientAddr }},
+	{"Remote", func(c *modifier.ConnInfo) string { return c.RemoteAddr }},
+	{"TLS", func(c *modifier.ConnInfo) string { return c.TLSVersion }},
+	{"Cipher", func(c *modifier.ConnInfo) string { return c.CipherSuite }},
+	{"ALPN", func(c *modifier.ConnInfo) string { return c.ALPN }},
+	{"SNI", func(c *modifier.ConnInfo) string { return c.SNI }},
+	{"DNS", timing(func(t *modifier.Timings) time.Duration { return t.DNS })},
+	{"Connect", timing(func(t *modifier.Timings) time.Duration { return t.Connect })},
+	{"Handshake", timing(func(t *modifier.Timings) time.Duration { return t.TLS })},
+	{"TTFB", timing(func(t *modifier.Timings) time.Duration { return t.TTFB })},
+	{"Transfer", timing(func(t *modifier.Timings) time.Duration { return t.Transfer })},
+}
+
+// firstConnColumn - the table column of the first optional column
+const firstConnColumn = 9
+
+func timing(get func(t *modifier.Timings) time.Duration) func(c *modifier.ConnInfo) string {
+	return func(c *modifier.ConnInfo) string {
+		if c.Timings == nil {
+			return ""
+		}
+		return formatDuration(get(c.Timings))
+	}
+}
+
+// formatDuration - a duration in milliseconds, empty for stages that didn't happen
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+}
+
+// setConnColumns - fill in the enabled optional columns for an entry's row
+func (view *ProxyView) setConnColumns(row int, e *modifier.Entry) {
+	col := firstConnColumn
+	for i, c := range connColumns {
+		if !view.columns[i] {
+			continue
+		}
+
+		text := ""
+		if e.Conn != nil {
+			text = c.value(e.Conn)
+		}
+		view.Table.SetCell(row, col, tview.NewTableCell(text))
+		col++
+	}
+}
+
+// columnsModal - choose which optional columns the proxy table shows
+func (view *ProxyView) columnsModal(app *tview.Application) {
+	form := tview.NewForm()
+	form.SetBorder(true)
+	form.SetTitle("Columns")
+	form.SetLabelColor(tcell.ColorMediumPurple)
+	form.SetItemPadding(0)
+
+	columns := make([]bool, len(connColumns))
+	copy(columns, view.columns)
+	for i, c := range connColumns {
+		form.AddCheckbox(c.name, columns[i], func(checked bool) {
+			columns[i] = checked
+		})
+	}
+
+	closeModal := func() {
+		view.Layout.HidePage("columnsmodal")
+		view.Layout.RemovePage("columnsmodal")
+		app.SetFocus(view.Table)
+	}
+
+	form.AddButton("Save", func() {
+		view.columns = columns
+		view.reloadtable()
+		closeModal()
+	})
+	form.AddButton("Cancel", closeModal)
+
+	form.SetCancelFunc(closeModal)
+
+	view.Layout.AddPage("columnsmodal", newmodal(form, 30, len(connColumns)+4), true, true)
+	app.SetFocus(form)
+}
+
+// connDetails - the connection metadata and timings of an entry, for the details pane
+func connDetails(e *modifier.Entry) string {
+	var b strings.Builder
+
+	row := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "[mediumpurple]%-10s[white] %s\n", name+":", tview.Escape(value))
+		}
+	}
+
+	row("Source", string(e.Source))
+	row("Tag", e.Tag)
+	if e.Blocked {
+		row("Blocked", "yes")
+	}
+	row("Fault", e.Fault)
+
+	if c := e.Conn; c != nil {
+		row("Client", c.ClientAddr)
+		row("Remote", c.RemoteAddr)
+		row("TLS", c.TLSVersion)
+		row("Cipher", c.CipherSuite)
+		row("ALPN", c.ALPN)
+		row("SNI", c.SNI)
+
+		if t := c.Timings; t != nil {
+			b.WriteString("\n")
+			if t.Reused {
+				row("Conn", "reused")
+			}
+			row("DNS", formatDuration(t.DNS))
+			row("Connect", formatDuration(t.Connect))
+			row("Handshake", formatDuration(t.TLS))
+			row("TTFB", formatDuration(t.TTFB))
+			row("Transfer", formatDuration(t.Transfer))
+		}
+	}
+	row("Total", formatDuration(time.Duration(e.Time)*time.Millisecond))
+
+	for _, f := range e.Findings {
+		fmt.Fprintf(&b, "\n[red]%s[white] %s\n", tview.Escape("["+f.Severity+"]"), tview.Escape(f.Name))
+	}
+
+	return b.String()
+}
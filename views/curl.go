@@ -3,9 +3,6 @@ package views
 import (
 	"bytes"
 	"fmt"
-	"io"
-	"log"
-	"net/http"
 	"strings"
 )
 
@@ -13,48 +10,70 @@ const (
 	hextable = "0123456789abcdef"
 )
 
-// take a net.http request and turn it into a curl command
-func reqToCurl(req *http.Request, url string) string {
+// exportCurl - turn a request into a curl command. Headers are sent in their original
+// order and case, bodies containing NUL bytes are fed through printf as bash can't
+// hold them in an ANSI-C quoted string
+func exportCurl(r *exportRequest) string {
 	var curlCmd []string
 
-	curlCmd = append(curlCmd, "curl")
-	curlCmd = append(curlCmd, "-X", req.Method)
+	curlCmd = append(curlCmd, "curl", "-k", "--path-as-is")
+	curlCmd = append(curlCmd, "-X", r.Method)
 
-	for k := range req.Header {
-		curlCmd = append(curlCmd, "-H", fmt.Sprintf("$'%s: %s'", k, strings.Join(req.Header[k], " ")))
+	for _, h := range r.Headers {
+		curlCmd = append(curlCmd, "-H", fmt.Sprintf("$'%s'", hexEscapeString(h[0]+": "+h[1])))
 	}
 
-	curlCmd = append(curlCmd, fmt.Sprintf("$'%s'", hexEscapeString(url)))
+	curlCmd = append(curlCmd, fmt.Sprintf("$'%s'", hexEscapeString(r.URL)))
 
-	if req.Body != nil {
-		var buf bytes.Buffer
-		_, err := buf.ReadFrom(req.Body)
-		if err != nil {
-			log.Printf("[!] Error copy-as-curl ReadFrom body buffer %s\n", err)
-			return ""
-		}
-		// reset body
-		req.Body = io.NopCloser(bytes.NewBuffer(buf.Bytes()))
+	if len(r.Body) > 0 {
+		curlCmd = append(curlCmd, "--data-binary", shellBody(r.Body, "@"))
+	}
+
+	return strings.Join(curlCmd, " ")
+}
+
+// exportWget - turn a request into a wget command
+func exportWget(r *exportRequest) string {
+	var wgetCmd []string
 
-		if len(buf.String()) > 0 {
-			bodyEscaped := fmt.Sprintf("$'%s'", hexEscapeString(buf.String()))
-			curlCmd = append(curlCmd, "--data-binary", bodyEscaped)
+	wgetCmd = append(wgetCmd, "wget", "-q", "-O", "-", "--no-check-certificate", "--method="+r.Method)
+
+	for _, h := range r.Headers {
+		wgetCmd = append(wgetCmd, fmt.Sprintf("--header=$'%s'", hexEscapeString(h[0]+": "+h[1])))
+	}
+
+	if len(r.Body) > 0 {
+		if bytes.IndexByte(r.Body, 0) == -1 {
+			wgetCmd = append(wgetCmd, "--body-data="+shellBody(r.Body, ""))
+		} else {
+			wgetCmd = append(wgetCmd, "--body-file="+shellBody(r.Body, ""))
 		}
 	}
 
-	return strings.Join(curlCmd, " ")
+	wgetCmd = append(wgetCmd, fmt.Sprintf("$'%s'", hexEscapeString(r.URL)))
+
+	return strings.Join(wgetCmd, " ")
+}
+
+// shellBody - quote a body for bash. Bodies with NUL bytes become a process
+// substitution, prefixed with filePrefix, that printf's the escaped bytes
+func shellBody(body []byte, filePrefix string) string {
+	if bytes.IndexByte(body, 0) == -1 {
+		return fmt.Sprintf("$'%s'", hexEscapeString(string(body)))
+	}
+	return fmt.Sprintf("%s<(printf '%%b' '%s')", filePrefix, hexEscapeString(string(body)))
 }
 
 // hexEscapeString take an input string and replaces any non alphanumsymbol chars
 // with their \x hex code. Specifically doing this with bytes, rather than runes
-// single quotes are the exception, these get escaped to play nice with shell
-// copy pastes
+// single quotes and backslashes are the exception, these get escaped to play nice
+// with shell copy pastes
 func hexEscapeString(s string) string {
 	bytes := []byte(s)
 	var out []byte
 
 	for i := range bytes {
-		if !isAsciiAlphaSymbolsSpace(bytes[i]) || bytes[i] == 0x27 {
+		if !isAsciiAlphaSymbolsSpace(bytes[i]) || bytes[i] == 0x27 || bytes[i] == 0x5c {
 			dst := make([]byte, 2)
 			dst[0] = hextable[bytes[i]>>4]
 			dst[1] = hextable[bytes[i]&0x0f]
@@ -0,0 +1,126 @@
+package views
+
+import (
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// markers used to make line endings visible in the built-in editor. Marker characters
+// that are part of the request are escaped with escMarker, so they survive an edit
+const (
+	crMarker  = "␍"
+	lfMarker  = "␊"
+	escMarker = "␛"
+)
+
+var (
+	lineEndingShower = strings.NewReplacer(
+		escMarker, escMarker+escMarker,
+		crMarker, escMarker+crMarker,
+		lfMarker, escMarker+lfMarker,
+		"\r", crMarker,
+		"\n", lfMarker+"\n",
+	)
+
+	// earlier pairs win, so an escaped marker is never read as a line ending
+	lineEndingHider = strings.NewReplacer(
+		escMarker+escMarker, escMarker,
+		escMarker+crMarker, crMarker,
+		escMarker+lfMarker, lfMarker,
+		lfMarker+"\n", "\n",
+		lfMarker, "\n",
+		crMarker, "\r",
+	)
+)
+
+// requestEditor - a TextArea that shows CR and LF characters as markers, so CRLF
+// sensitive payloads can be edited without losing track of line endings
+type requestEditor struct {
+	*tview.TextArea
+}
+
+func newRequestEditor(data []byte) *requestEditor {
+	e := &requestEditor{tview.NewTextArea()}
+	e.SetText(showLineEndings(string(data)), false)
+	return e
+}
+
+// InputHandler - enter inserts a CRLF, alt-enter a bare LF
+func (e *requestEditor) InputHandler() func(event *tcell.EventKey, setFocus func(p tview.Primitive)) {
+	handler := e.TextArea.InputHandler()
+	return func(event *tcell.EventKey, setFocus func(p tview.Primitive)) {
+		if event.Key() == tcell.KeyEnter {
+			if event.Modifiers()&tcell.ModAlt == 0 {
+				handler(tcell.NewEventKey(tcell.KeyRune, []rune(crMarker)[0], tcell.ModNone), setFocus)
+			}
+			handler(tcell.NewEventKey(tcell.KeyRune, []rune(lfMarker)[0], tcell.ModNone), setFocus)
+			event = tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone)
+		}
+		handler(event, setFocus)
+	}
+}
+
+// PasteHandler - pasted text gets its line endings marked like the rest of the request
+func (e *requestEditor) PasteHandler() func(pastedText string, setFocus func(p tview.Primitive)) {
+	handler := e.TextArea.PasteHandler()
+	return func(pastedText string, setFocus func(p tview.Primitive)) {
+		handler(showLineEndings(pastedText), setFocus)
+	}
+}
+
+// GetBytes - the edited request with the markers turned back into CR and LF bytes
+func (e *requestEditor) GetBytes() []byte {
+	return []byte(hideLineEndings(e.GetText()))
+}
+
+// showLineEndings - put a marker in front of every line feed and replace carriage
+// returns with their marker
+func showLineEndings(s string) string {
+	return lineEndingShower.Replace(s)
+}
+
+// hideLineEndings - reverse showLineEndings. A line feed marker on its own is still a
+// line feed, and a line break without a marker is kept as is
+func hideLineEndings(s string) string {
+	return lineEndingHider.Replace(s)
+}
+
+// editorPage - edit the selected replay request in the built-in editor. ctrl-s
+// stores the change, esc throws it away
+func (view *ReplayView) editorPage(app *tview.Application, rr *ReplayRequests) {
+	req := rr.elements[rr.index]
+
+	editor := newRequestEditor(req.RawRequest)
+	editor.SetBorder(true)
+	editor.SetTitle("Edit Request - " + rr.ID + " - ctrl-s save, esc cancel, alt-enter bare LF")
+
+	closePage := func() {
+		view.Layout.HidePage("editorpage")
+		view.Layout.RemovePage("editorpage")
+		app.SetFocus(view.request)
+	}
+
+	layout := tview.NewFlex()
+	layout.AddItem(editor, 0, 1, true)
+	layout.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyCtrlS:
+			updateRawRequest(rr, req, editor.GetBytes())
+			closePage()
+			view.refreshReplay(rr)
+			if view.autoSend.IsChecked() {
+				view.sendRequest(app, rr.ID)
+			}
+			return nil
+		case tcell.KeyESC:
+			closePage()
+			return nil
+		}
+		return event
+	})
+
+	view.Layout.AddPage("editorpage", layout, true, true)
+	app.SetFocus(editor)
+}
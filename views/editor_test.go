@@ -0,0 +1,21 @@
+package views
+
+import "testing"
+
+func TestLineEndings(t *testing.T) {
+	tests := []string{
+		"GET / HTTP/1.1\r\nHost: x\r\n\r\n",
+		"POST / HTTP/1.1\r\n\r\na=␍␊&b=␛␊\n\r&c=␛",
+		"bare\nline feeds\n",
+	}
+	for _, s := range tests {
+		if got := hideLineEndings(showLineEndings(s)); got != s {
+			t.Errorf("TestLineEndings round trip got %q want %q", got, s)
+		}
+	}
+
+	// markers typed in the editor become line endings
+	if got := hideLineEndings("a␍␊\nb␊c"); got != "a\r\nb\nc" {
+		t.Errorf("TestLineEndings got %q want %q", got, "a\r\nb\nc")
+	}
+}
@@ -0,0 +1,403 @@
+package views
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/denandz/glorp/replay"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// exportRequest - a request parsed from raw bytes, keeping the header order and case
+type exportRequest struct {
+	Method  string
+	Target  string      // the request target as written on the request line
+	URL     string      // the absolute URL the request is sent to
+	Headers [][2]string // name, value pairs in their original order
+	Body    []byte
+	Raw     []byte
+}
+
+// exportTargets - the export menu entries, in the order they're shown
+var exportTargets = []struct {
+	name   string
+	export func(*exportRequest) string
+}{
+	{"curl", exportCurl},
+	{"wget", exportWget},
+	{"Python requests", exportPython},
+	{"Go net/http", exportGo},
+	{"JavaScript fetch", exportFetch},
+	{"PowerShell", exportPowerShell},
+	{"Raw HTTP", exportRaw},
+}
+
+// parseExportRequest - split a raw HTTP/1.x request, or an HTTP/2 request in the
+// replay pseudo-header format, into its parts without normalising anything
+func parseExportRequest(raw []byte) (*exportRequest, error) {
+	r := &exportRequest{Raw: raw}
+
+	if bytes.HasPrefix(raw, []byte(":")) {
+		fields, body, err := replay.ParseH2Request(raw)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range fields {
+			switch f.Name {
+			case ":method":
+				r.Method = f.Value
+			case ":path":
+				r.Target = f.Value
+			case ":authority":
+				r.Headers = append(r.Headers, [2]string{"Host", f.Value})
+			case ":scheme":
+			default:
+				r.Headers = append(r.Headers, [2]string{f.Name, f.Value})
+			}
+		}
+		r.Body = body
+		return r, nil
+	}
+
+	head, body, found := bytes.Cut(raw, []byte("\r\n\r\n"))
+	if !found {
+		head, body, _ = bytes.Cut(raw, []byte("\n\n"))
+	}
+	r.Body = body
+
+	lines := strings.Split(string(head), "\n")
+	requestLine := strings.Fields(lines[0])
+	if len(requestLine) < 2 {
+		return nil, fmt.Errorf("bad request line %q", lines[0])
+	}
+	r.Method, r.Target = requestLine[0], requestLine[1]
+
+	for _, line := range lines[1:] {
+		line = strings.TrimSuffix(line, "\r")
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(r.Headers) > 0 {
+			// obsolete line folding, keep it with the previous header
+			r.Headers[len(r.Headers)-1][1] += " " + strings.TrimSpace(line)
+			continue
+		}
+
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		r.Headers = append(r.Headers, [2]string{name, strings.TrimLeft(value, " \t")})
+	}
+
+	return r, nil
+}
+
+// header - the value of the first header with the given name, matched case insensitively
+func (r *exportRequest) header(name string) string {
+	for _, h := range r.Headers {
+		if strings.EqualFold(h[0], name) {
+			return h[1]
+		}
+	}
+	return ""
+}
+
+// replayURL - work out the absolute URL a replay request is sent to
+func replayURL(req *replay.Request, target string) string {
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		return target
+	}
+
+	scheme := "http"
+	defaultPort := "80"
+	if req.TLS {
+		scheme = "https"
+		defaultPort = "443"
+	}
+
+	host := req.Host
+	if req.Port != defaultPort {
+		host = net.JoinHostPort(req.Host, req.Port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+
+	return scheme + "://" + host + target
+}
+
+// exportModal - show the export menu for a request. The chosen export is handed to
+// done, or shown in a page where it can be saved or copied when done is nil. Focus
+// returns to back once the page is closed
+func exportModal(app *tview.Application, page *tview.Pages, back tview.Primitive, r *exportRequest, done func(title, out string)) {
+	list := tview.NewList()
+	list.ShowSecondaryText(false)
+	list.SetBorder(true)
+	list.SetTitle("Export as")
+
+	closeModal := func() {
+		page.HidePage("exportmodal")
+		page.RemovePage("exportmodal")
+		app.SetFocus(back)
+	}
+
+	for _, t := range exportTargets {
+		list.AddItem(t.name, "", 0, func() {
+			closeModal()
+			out := t.export(r)
+			if done != nil {
+				done(t.name, out)
+				return
+			}
+			log.Println(out)
+
+			// Copy and pasting out of the log view is a pain due to word wrapping
+			// spit out the export on stderr as well so can read it from a
+			// 2> redirected output file
+			o, _ := os.Stderr.Stat()
+			if (o.Mode() & os.ModeCharDevice) != os.ModeCharDevice {
+				fmt.Fprintln(os.Stderr, out)
+			}
+
+			exportPage(app, page, back, t.name, out)
+		})
+	}
+
+	list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyESC {
+			closeModal()
+			return nil
+		}
+		return event
+	})
+
+	page.AddPage("exportmodal", newmodal(list, 30, len(exportTargets)+2), true, true)
+	app.SetFocus(list)
+}
+
+// exportPage - display an export, ctrl-s saves it to a file, ctrl-y copies it and esc closes it
+func exportPage(app *tview.Application, page *tview.Pages, back tview.Primitive, title, out string) {
+	text := NewTextPrimitive()
+	text.SetBorder(true)
+	text.SetTitle("Export - " + title + " - ctrl-s save, ctrl-y copy, esc close")
+	fmt.Fprint(text, out)
+	fmt.Fprint(text, "\u2800")
+
+	text.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyCtrlS:
+			saveModal(app, page, []byte(out))
+			return nil
+		case tcell.KeyCtrlY:
+			copyToClipboard(app, page, title, []byte(out))
+			return nil
+		case tcell.KeyESC:
+			page.HidePage("exportpage")
+			page.RemovePage("exportpage")
+			app.SetFocus(back)
+			return nil
+		}
+		return event
+	})
+
+	page.AddPage("exportpage", text, true, true)
+	app.SetFocus(text)
+}
+
+// isPlainText - true if the body can be written as a simple single line string
+func isPlainText(b []byte) bool {
+	for _, c := range b {
+		if !isAsciiAlphaSymbolsSpace(c) && c != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// pyBytes - a python bytes literal holding exactly b
+func pyBytes(b []byte) string {
+	var out strings.Builder
+	out.WriteString("b'")
+	for _, c := range b {
+		switch {
+		case c == '\'' || c == '\\':
+			out.WriteByte('\\')
+			out.WriteByte(c)
+		case isAsciiAlphaSymbolsSpace(c):
+			out.WriteByte(c)
+		default:
+			fmt.Fprintf(&out, "\\x%02x", c)
+		}
+	}
+	out.WriteString("'")
+	return out.String()
+}
+
+// pyString - a python string literal, the request line and headers are latin-1 on the wire
+func pyString(s string) string {
+	return strings.TrimPrefix(pyBytes([]byte(s)), "b")
+}
+
+// exportPython - turn a request into a python requests snippet. Duplicate headers are
+// joined with a comma as requests takes a dict
+func exportPython(r *exportRequest) string {
+	var b strings.Builder
+
+	b.WriteString("import requests\n\n")
+	b.WriteString("headers = {\n")
+	var names []string
+	values := make(map[string]string)
+	for _, h := range r.Headers {
+		if v, ok := values[h[0]]; ok {
+			values[h[0]] = v + ", " + h[1]
+			continue
+		}
+		names = append(names, h[0])
+		values[h[0]] = h[1]
+	}
+	for _, name := range names {
+		fmt.Fprintf(&b, "    %s: %s,\n", pyString(name), pyString(values[name]))
+	}
+	b.WriteString("}\n")
+	fmt.Fprintf(&b, "data = %s\n\n", pyBytes(r.Body))
+	fmt.Fprintf(&b, "response = requests.request(%s, %s, headers=headers, data=data, verify=False, allow_redirects=False)\n", pyString(r.Method), pyString(r.URL))
+	b.WriteString("print(response.status_code)\nprint(response.text)\n")
+
+	return b.String()
+}
+
+// exportGo - turn a request into a Go net/http program. Headers are assigned straight
+// into the header map so their case is kept, Host is moved to req.Host as net/http
+// ignores it in the map
+func exportGo(r *exportRequest) string {
+	var b strings.Builder
+
+	b.WriteString("package main\n\n")
+	b.WriteString("import (\n\t\"crypto/tls\"\n\t\"fmt\"\n\t\"io\"\n\t\"net/http\"\n\t\"strings\"\n)\n\n")
+	b.WriteString("func main() {\n")
+	fmt.Fprintf(&b, "\tbody := strings.NewReader(%s)\n", strconv.Quote(string(r.Body)))
+	fmt.Fprintf(&b, "\treq, err := http.NewRequest(%s, %s, body)\n", strconv.Quote(r.Method), strconv.Quote(r.URL))
+	b.WriteString("\tif err != nil {\n\t\tpanic(err)\n\t}\n\n")
+
+	for _, h := range r.Headers {
+		switch strings.ToLower(h[0]) {
+		case "host":
+			fmt.Fprintf(&b, "\treq.Host = %s\n", strconv.Quote(h[1]))
+		case "content-length":
+			// net/http sets this from the body
+		default:
+			fmt.Fprintf(&b, "\treq.Header[%s] = append(req.Header[%s], %s)\n", strconv.Quote(h[0]), strconv.Quote(h[0]), strconv.Quote(h[1]))
+		}
+	}
+
+	b.WriteString("\n\tclient := &http.Client{\n")
+	b.WriteString("\t\tTransport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},\n")
+	b.WriteString("\t\tCheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },\n")
+	b.WriteString("\t}\n")
+	b.WriteString("\tresp, err := client.Do(req)\n")
+	b.WriteString("\tif err != nil {\n\t\tpanic(err)\n\t}\n")
+	b.WriteString("\tdefer resp.Body.Close()\n\n")
+	b.WriteString("\tdata, _ := io.ReadAll(resp.Body)\n")
+	b.WriteString("\tfmt.Println(resp.Status)\n\tfmt.Println(string(data))\n")
+	b.WriteString("}\n")
+
+	return b.String()
+}
+
+// jsString - a javascript string literal
+func jsString(s string) string {
+	out, _ := json.Marshal(s)
+	return string(out)
+}
+
+// exportFetch - turn a request into a fetch call. Headers are passed as pairs so
+// duplicates survive, browsers will drop the ones they control such as Host
+func exportFetch(r *exportRequest) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "fetch(%s, {\n", jsString(r.URL))
+	fmt.Fprintf(&b, "  method: %s,\n", jsString(r.Method))
+	b.WriteString("  headers: [\n")
+	for _, h := range r.Headers {
+		if strings.EqualFold(h[0], "content-length") {
+			continue
+		}
+		fmt.Fprintf(&b, "    [%s, %s],\n", jsString(h[0]), jsString(h[1]))
+	}
+	b.WriteString("  ],\n")
+
+	if len(r.Body) > 0 {
+		if isPlainText(r.Body) {
+			fmt.Fprintf(&b, "  body: %s,\n", jsString(string(r.Body)))
+		} else {
+			nums := make([]string, len(r.Body))
+			for i, c := range r.Body {
+				nums[i] = strconv.Itoa(int(c))
+			}
+			fmt.Fprintf(&b, "  body: new Uint8Array([%s]),\n", strings.Join(nums, ","))
+		}
+	}
+
+	b.WriteString("  credentials: \"include\",\n")
+	b.WriteString("  redirect: \"manual\",\n")
+	b.WriteString("}).then(r => r.text()).then(console.log);\n")
+
+	return b.String()
+}
+
+// psString - a powershell single quoted string
+func psString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// exportPowerShell - turn a request into an Invoke-WebRequest call. Anything other
+// than a plain text body is passed as base64 decoded bytes so it arrives unchanged
+func exportPowerShell(r *exportRequest) string {
+	var b strings.Builder
+
+	b.WriteString("$headers = @{\n")
+	var names []string
+	values := make(map[string]string)
+	for _, h := range r.Headers {
+		switch strings.ToLower(h[0]) {
+		case "content-length", "content-type":
+			continue
+		}
+		if v, ok := values[h[0]]; ok {
+			values[h[0]] = v + ", " + h[1]
+			continue
+		}
+		names = append(names, h[0])
+		values[h[0]] = h[1]
+	}
+	for _, name := range names {
+		fmt.Fprintf(&b, "    %s = %s\n", psString(name), psString(values[name]))
+	}
+	b.WriteString("}\n")
+
+	fmt.Fprintf(&b, "Invoke-WebRequest -Uri %s -Method %s -Headers $headers", psString(r.URL), psString(r.Method))
+	if ct := r.header("Content-Type"); ct != "" {
+		fmt.Fprintf(&b, " -ContentType %s", psString(ct))
+	}
+	if len(r.Body) > 0 {
+		if isPlainText(r.Body) {
+			fmt.Fprintf(&b, " -Body %s", psString(string(r.Body)))
+		} else {
+			fmt.Fprintf(&b, " -Body ([Convert]::FromBase64String('%s'))", base64.StdEncoding.EncodeToString(r.Body))
+		}
+	}
+	b.WriteString(" -SkipCertificateCheck -SkipHeaderValidation -MaximumRedirection 0\n")
+
+	return b.String()
+}
+
+// exportRaw - the request exactly as it would be sent
+func exportRaw(r *exportRequest) string {
+	return string(r.Raw)
+}
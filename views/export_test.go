@@ -0,0 +1,105 @@
+package views
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseExportRequest(t *testing.T) {
+	raw := []byte("POST /a HTTP/1.1\r\nHost: example.com\r\nX-Test: 1\r\nx-test: 2\r\n\r\n\x00\r\n\xff")
+
+	r, err := parseExportRequest(raw)
+	if err != nil {
+		t.Fatalf("TestParseExportRequest unexpected error: %v", err)
+	}
+
+	if r.Method != "POST" || r.Target != "/a" {
+		t.Errorf("TestParseExportRequest unexpected request line: got %v %v want %v %v", r.Method, r.Target, "POST", "/a")
+	}
+
+	if l := len(r.Headers); l != 3 {
+		t.Fatalf("TestParseExportRequest unexpected number of headers: got %v want %v", l, 3)
+	}
+
+	if h := r.Headers[2][0]; h != "x-test" {
+		t.Errorf("TestParseExportRequest header case not kept: got %v want %v", h, "x-test")
+	}
+
+	if string(r.Body) != "\x00\r\n\xff" {
+		t.Errorf("TestParseExportRequest unexpected body: got %q want %q", r.Body, "\x00\r\n\xff")
+	}
+
+	if s := hexEscapeString(`a'\`); s != `a\x27\x5c` {
+		t.Errorf("TestParseExportRequest unexpected escaping: got %v want %v", s, `a\x27\x5c`)
+	}
+}
+
+func TestExportTargets(t *testing.T) {
+	raw := []byte("POST /a?b=1 HTTP/1.1\r\nHost: example.com\r\nX-Dup: 1\r\nX-Dup: 2\r\nCookie: a=b; c=d\r\nContent-Type: application/octet-stream\r\nContent-Length: 6\r\n\r\n\x00\r\n\xff'\\")
+
+	r, err := parseExportRequest(raw)
+	if err != nil {
+		t.Fatalf("TestExportTargets unexpected error: %v", err)
+	}
+	r.URL = "https://example.com/a?b=1"
+
+	// what each export has to contain, in order
+	want := map[string][]string{
+		"curl": {
+			`-X POST`,
+			`-H $'X-Dup: 1'`, `-H $'X-Dup: 2'`, `-H $'Cookie: a=b; c=d'`,
+			`$'https://example.com/a?b=1'`,
+			`--data-binary @<(printf '%b' '\x00\x0d\x0a\xff\x27\x5c')`,
+		},
+		"wget": {
+			`--method=POST`,
+			`--header=$'X-Dup: 1'`, `--header=$'X-Dup: 2'`, `--header=$'Cookie: a=b; c=d'`,
+			`--body-file=<(printf '%b' '\x00\x0d\x0a\xff\x27\x5c')`,
+			`$'https://example.com/a?b=1'`,
+		},
+		"Python requests": {
+			`'X-Dup': '1, 2',`, `'Cookie': 'a=b; c=d',`,
+			`data = b'\x00\x0d\x0a\xff\'\\'`,
+			`requests.request('POST', 'https://example.com/a?b=1'`,
+		},
+		"Go net/http": {
+			`strings.NewReader("\x00\r\n\xff'\\")`,
+			`http.NewRequest("POST", "https://example.com/a?b=1", body)`,
+			`req.Host = "example.com"`,
+			`req.Header["X-Dup"] = append(req.Header["X-Dup"], "1")`,
+			`req.Header["X-Dup"] = append(req.Header["X-Dup"], "2")`,
+			`req.Header["Cookie"] = append(req.Header["Cookie"], "a=b; c=d")`,
+		},
+		"JavaScript fetch": {
+			`fetch("https://example.com/a?b=1"`, `method: "POST"`,
+			`["X-Dup", "1"]`, `["X-Dup", "2"]`, `["Cookie", "a=b; c=d"]`,
+			`body: new Uint8Array([0,13,10,255,39,92])`,
+		},
+		"PowerShell": {
+			`'X-Dup' = '1, 2'`, `'Cookie' = 'a=b; c=d'`,
+			`-Uri 'https://example.com/a?b=1' -Method 'POST'`,
+			`-ContentType 'application/octet-stream'`,
+			`-Body ([Convert]::FromBase64String('AA0K/ydc'))`,
+		},
+		"Raw HTTP": {string(raw)},
+	}
+
+	for _, target := range exportTargets {
+		parts, ok := want[target.name]
+		if !ok {
+			t.Errorf("TestExportTargets no expected output for %s", target.name)
+			continue
+		}
+
+		out := target.export(r)
+		rest := out
+		for _, part := range parts {
+			i := strings.Index(rest, part)
+			if i == -1 {
+				t.Errorf("TestExportTargets %s missing %q in order, got:\n%s", target.name, part, out)
+				break
+			}
+			rest = rest[i+len(part):]
+		}
+	}
+}
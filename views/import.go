@@ -0,0 +1,109 @@
+package views
+
+import (
+	"bytes"
+	"container/ring"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/denandz/glorp/replay"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// importModal - create a replay item from a pasted curl command or raw HTTP request,
+// or from a file holding either of them
+func (view *ReplayView) importModal(app *tview.Application) {
+	fileInput := tview.NewInputField()
+	fileInput.SetLabel("File ")
+	fileInput.SetLabelColor(tcell.ColorMediumPurple)
+
+	text := tview.NewTextArea()
+	text.SetBorder(true)
+	text.SetTitle("curl command or raw request")
+
+	modal := tview.NewFlex()
+	closeModal := func() {
+		view.Layout.HidePage("importmodal")
+		view.Layout.RemovePage("importmodal")
+		app.SetFocus(view.Table)
+	}
+
+	importButton := tview.NewButton("Import").SetSelectedFunc(func() {
+		data := []byte(text.GetText())
+		if name := strings.TrimSpace(fileInput.GetText()); name != "" {
+			var err error
+			if data, err = os.ReadFile(name); err != nil {
+				log.Printf("[!] ReplayView - import - %s\n", err)
+				modal.SetTitle("Import - " + err.Error())
+				return
+			}
+		}
+
+		r, err := importRequest(data)
+		if err != nil {
+			log.Printf("[!] ReplayView - import - %s\n", err)
+			modal.SetTitle("Import - " + err.Error())
+			return
+		}
+
+		closeModal()
+		view.AddItem(r)
+	})
+
+	modal.SetBorder(true)
+	modal.SetDirection(tview.FlexRow)
+	modal.SetTitle("Import")
+	modal.AddItem(fileInput, 1, 1, false)
+	modal.AddItem(text, 0, 1, true)
+	modal.AddItem(importButton, 1, 1, false)
+
+	items := []tview.Primitive{text, importButton, fileInput}
+	r := ring.New(len(items))
+	for i := range items {
+		r.Value = items[i]
+		r = r.Next()
+	}
+
+	modal.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyTab:
+			r = r.Next()
+			app.SetFocus(r.Value.(tview.Primitive))
+			return nil
+		case tcell.KeyBacktab:
+			r = r.Prev()
+			app.SetFocus(r.Value.(tview.Primitive))
+			return nil
+		case tcell.KeyESC:
+			closeModal()
+			return nil
+		}
+		return event
+	})
+
+	view.Layout.AddPage("importmodal", newmodal(modal, 80, 20), true, true)
+	app.SetFocus(text)
+}
+
+// importRequest - parse a curl command or a raw request. Raw requests that were
+// pasted or written with bare line feeds get CRLF line endings in their headers
+func importRequest(data []byte) (*replay.Request, error) {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("curl ")) || bytes.HasPrefix(trimmed, []byte("curl.exe ")) {
+		return replay.FromCurl(string(trimmed))
+	}
+
+	data = bytes.TrimLeft(data, "\r\n")
+	if !bytes.Contains(data, []byte("\r\n")) {
+		head, body, _ := bytes.Cut(data, []byte("\n\n"))
+		head = bytes.TrimRight(head, "\n")
+		data = bytes.ReplaceAll(head, []byte("\n"), []byte("\r\n"))
+		data = append(data, "\r\n\r\n"...)
+		data = append(data, body...)
+	}
+
+	return replay.FromRaw(data)
+}
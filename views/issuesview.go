@@ -0,0 +1,229 @@
+package views
+
+import (
+	"container/ring"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/denandz/glorp/modifier"
+	"github.com/denandz/glorp/scanner"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// IssuesView - the issues the passive scanner has found in proxied traffic
+type IssuesView struct {
+	Layout     *tview.Pages
+	Table      *tview.Table
+	detailsBox *tview.TextView
+	Scanner    *scanner.Scanner
+	Logger     *modifier.Logger
+}
+
+// GetView - should return a title and the top-level primitive
+func (view *IssuesView) GetView() (title string, content tview.Primitive) {
+	return "Issues", view.Layout
+}
+
+// Init - Initialize the issues view, channel gets the IDs of issues the scanner finds or updates
+func (view *IssuesView) Init(app *tview.Application, s *scanner.Scanner, logger *modifier.Logger, channel chan string) {
+	view.Scanner = s
+	view.Logger = logger
+
+	view.Layout = tview.NewPages()
+	mainLayout := tview.NewFlex().SetDirection(tview.FlexRow)
+
+	view.Table = tview.NewTable()
+	view.Table.SetFixed(1, 0)
+	view.Table.SetBorders(false).SetSeparator(tview.Borders.Vertical)
+	view.Table.SetSelectable(true, false)
+	view.setHeaders()
+
+	view.detailsBox = tview.NewTextView()
+	view.detailsBox.SetDynamicColors(true)
+	view.detailsBox.SetBorder(true)
+	view.detailsBox.SetTitle("Details")
+
+	mainLayout.AddItem(view.Table, 0, 1, true)
+	mainLayout.AddItem(view.detailsBox, 0, 2, false)
+	view.Layout.AddPage("mainlayout", mainLayout, true, true)
+
+	// focus ring
+	items := []tview.Primitive{view.Table, view.detailsBox}
+	focusRing := ring.New(len(items))
+	for i := range items {
+		focusRing.Value = items[i]
+		focusRing = focusRing.Next()
+	}
+
+	view.Table.SetSelectionChangedFunc(func(row int, column int) {
+		view.showIssue(view.selected())
+	})
+
+	view.Table.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyCtrlD:
+			if id := view.selected(); id != "" {
+				view.Scanner.Remove(id)
+				view.Reload()
+			}
+			return nil
+		}
+
+		switch event.Rune() {
+		case 'g':
+			view.Table.ScrollToBeginning()
+		case 'G':
+			view.Table.ScrollToEnd()
+		}
+		return event
+	})
+
+	mainLayout.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyTAB:
+			focusRing = focusRing.Next()
+			app.SetFocus(focusRing.Value.(tview.Primitive))
+		case tcell.KeyBacktab:
+			focusRing = focusRing.Prev()
+			app.SetFocus(focusRing.Value.(tview.Primitive))
+		}
+		return event
+	})
+
+	view.issueReceiver(app, channel)
+}
+
+// issueReceiver - reload the table as issues come in. Notifications that pile up while
+// waiting to draw are handled by the one reload
+func (view *IssuesView) issueReceiver(app *tview.Application, channel chan string) {
+	if channel == nil {
+		return
+	}
+
+	go func() {
+		for range channel {
+			for len(channel) > 0 {
+				<-channel
+			}
+			app.QueueUpdateDraw(view.Reload)
+		}
+	}()
+}
+
+func (view *IssuesView) setHeaders() {
+	for c, name := range []string{"Severity", "Issue", "Host", "Path", "Count"} {
+		view.Table.SetCell(0, c, tview.NewTableCell(name).SetTextColor(tcell.ColorMediumPurple).SetSelectable(false))
+	}
+}
+
+// selected - the ID of the selected issue, empty if there isn't one
+func (view *IssuesView) selected() string {
+	row, _ := view.Table.GetSelection()
+	if row < 1 || row >= view.Table.GetRowCount() {
+		return ""
+	}
+	id, _ := view.Table.GetCell(row, 0).GetReference().(string)
+	return id
+}
+
+// Reload - refill the table from the scanner, keeping the selected issue selected
+func (view *IssuesView) Reload() {
+	id := view.selected()
+	row, _ := view.Table.GetSelection()
+
+	view.Table.Clear()
+	view.setHeaders()
+
+	for i, is := range view.Scanner.Issues() {
+		n := i + 1
+		path := is.Path
+		if len(path) > 100 {
+			path = string([]rune(path)[0:100])
+		}
+
+		view.Table.SetCell(n, 0, tview.NewTableCell(is.Severity).SetTextColor(severityColor(is.Severity)).SetReference(is.ID))
+		view.Table.SetCell(n, 1, tview.NewTableCell(is.Name))
+		view.Table.SetCell(n, 2, tview.NewTableCell(is.Host))
+		view.Table.SetCell(n, 3, tview.NewTableCell(path).SetExpansion(1))
+		view.Table.SetCell(n, 4, tview.NewTableCell(strconv.Itoa(is.Count)))
+
+		if is.ID == id {
+			row = n
+		}
+	}
+
+	// a removed issue's row goes to the one after it
+	view.Table.Select(min(max(row, 1), max(view.Table.GetRowCount()-1, 1)), 0)
+	view.showIssue(view.selected())
+}
+
+func severityColor(severity string) tcell.Color {
+	switch severity {
+	case modifier.SeverityHigh:
+		return tcell.ColorRed
+	case modifier.SeverityMedium:
+		return tcell.ColorOrange
+	case modifier.SeverityLow:
+		return tcell.ColorYellow
+	}
+	return tcell.ColorLightBlue
+}
+
+// showIssue - fill the details box with an issue and the message it was first found in,
+// its evidence highlighted
+func (view *IssuesView) showIssue(id string) {
+	view.detailsBox.Clear()
+
+	is := view.Scanner.Get(id)
+	if is == nil {
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s]%s[white] %s\n", severityColor(is.Severity).String(), tview.Escape("["+is.Severity+"]"), tview.Escape(is.Name))
+	fmt.Fprintf(&b, "%s%s\n\n", tview.Escape(is.Host), tview.Escape(is.Path))
+	if is.Detail != "" {
+		fmt.Fprintf(&b, "%s\n\n", tview.Escape(is.Detail))
+	}
+	fmt.Fprintf(&b, "[mediumpurple]Found in[white] %d entries: %s\n", is.Count, strings.Join(is.Entries, ", "))
+
+	if is.Location != "" && len(is.Entries) > 0 {
+		if e := view.Logger.GetEntry(is.Entries[0]); e != nil {
+			fmt.Fprintf(&b, "\n[mediumpurple]%s %s[white]\n\n", strings.ToUpper(is.Location[:1])+is.Location[1:], e.ID)
+			b.WriteString(highlight(scanner.Text(e, is.Location), is.Evidence))
+		}
+	}
+
+	fmt.Fprint(view.detailsBox, b.String())
+	view.detailsBox.ScrollToBeginning()
+}
+
+// highlight - escape text for a dynamic color text view, with each piece of evidence in it highlighted
+func highlight(text string, evidence []string) string {
+	var b strings.Builder
+
+	for {
+		start, end := -1, -1
+		for _, ev := range evidence {
+			if ev == "" {
+				continue
+			}
+			if i := strings.Index(text, ev); i != -1 && (start == -1 || i < start) {
+				start, end = i, i+len(ev)
+			}
+		}
+		if start == -1 {
+			break
+		}
+
+		b.WriteString(tview.Escape(text[:start]))
+		b.WriteString("[black:yellow]" + tview.Escape(text[start:end]) + "[-:-]")
+		text = text[end:]
+	}
+
+	b.WriteString(tview.Escape(text))
+	return b.String()
+}
@@ -0,0 +1,149 @@
+package views
+
+import (
+	"bytes"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/denandz/glorp/replay"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// protocol drop down options and the replay protocol each one maps to
+var protoNames = []string{"HTTP/1", "HTTP/2", "h2c Upgrade"}
+var protoValues = []string{replay.ProtoHTTP1, replay.ProtoH2, replay.ProtoH2CUpgrade}
+
+func protoIndex(protocol string) int {
+	for i, p := range protoValues {
+		if p == protocol {
+			return i
+		}
+	}
+	return 0
+}
+
+// setProtocol - change the protocol of the selected replay element. Switching an
+// HTTP/1 request to HTTP/2 rewrites it in the pseudo-header format. An element that
+// has been sent keeps the protocol it went out with, the change goes on a new one
+func (view *ReplayView) setProtocol(rr *ReplayRequests, protocol string) {
+	rr.mu.Lock()
+	r := rr.elements[rr.index]
+	if r.Protocol == protocol {
+		rr.mu.Unlock()
+		return
+	}
+
+	if len(r.RawResponse) > 0 {
+		r = nextElement(rr, r)
+	}
+	r.Protocol = protocol
+
+	if protocol != replay.ProtoHTTP1 && len(r.RawRequest) > 0 && !bytes.HasPrefix(r.RawRequest, []byte(":")) {
+		r.RawRequest = replay.ToH2Request(r.RawRequest, r.TLS)
+		r.Template = nil
+	}
+	rr.mu.Unlock()
+
+	view.refreshReplay(rr)
+}
+
+// optionsModal - edit the low level send options for the selected replay element
+func (view *ReplayView) optionsModal(app *tview.Application) {
+	rr, ok := view.replays[view.id]
+	if !ok {
+		return
+	}
+	r := rr.elements[rr.index]
+
+	form := tview.NewForm()
+	form.SetBorder(true)
+	form.SetTitle("Options - " + rr.ID)
+	form.SetLabelColor(tcell.ColorMediumPurple)
+
+	form.SetItemPadding(0)
+
+	split := strconv.Itoa(r.H2HeaderSplit)
+	form.AddInputField("H2 header split", split, 10, tview.InputFieldInteger, func(text string) {
+		split = text
+	})
+
+	opts := r.TLSOptions
+	versions := append([]string{"default"}, replay.TLSVersions...)
+	form.AddInputField("TLS SNI", opts.SNI, 40, nil, func(text string) {
+		opts.SNI = text
+	})
+	form.AddDropDown("TLS min version", versions, versionIndex(opts.MinVersion), func(option string, index int) {
+		opts.MinVersion = tlsVersion(index)
+	})
+	form.AddDropDown("TLS max version", versions, versionIndex(opts.MaxVersion), func(option string, index int) {
+		opts.MaxVersion = tlsVersion(index)
+	})
+	form.AddInputField("TLS ciphers", strings.Join(opts.Ciphers, ","), 40, nil, func(text string) {
+		opts.Ciphers = splitList(text)
+	})
+	form.AddInputField("TLS ALPN", strings.Join(opts.ALPN, ","), 40, nil, func(text string) {
+		opts.ALPN = splitList(text)
+	})
+	form.AddInputField("Client cert", opts.ClientCert, 40, nil, func(text string) {
+		opts.ClientCert = text
+	})
+	form.AddInputField("Client key", opts.ClientKey, 40, nil, func(text string) {
+		opts.ClientKey = text
+	})
+
+	closeModal := func() {
+		view.Layout.HidePage("optionsmodal")
+		view.Layout.RemovePage("optionsmodal")
+		app.SetFocus(view.Table)
+	}
+
+	form.AddButton("Save", func() {
+		n, _ := strconv.Atoi(split)
+		r.H2HeaderSplit = max(n, 0)
+
+		if _, err := opts.Config(nil); err != nil {
+			log.Printf("[!] ReplayView - options - %s\n", err)
+			notifModal(app, view.Layout, err.Error())
+			return
+		}
+		r.TLSOptions = opts
+		closeModal()
+	})
+	form.AddButton("Cancel", closeModal)
+
+	form.SetCancelFunc(closeModal)
+
+	view.Layout.AddPage("optionsmodal", newmodal(form, 62, 14), true, true)
+	app.SetFocus(form)
+}
+
+// versionIndex - the TLS version drop down index for a version, 0 is the default
+func versionIndex(version string) int {
+	for i, v := range replay.TLSVersions {
+		if v == version {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func tlsVersion(index int) string {
+	if index < 1 || index > len(replay.TLSVersions) {
+		return ""
+	}
+	return replay.TLSVersions[index-1]
+}
+
+// splitList - split a comma separated list, dropping empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
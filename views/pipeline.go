@@ -0,0 +1,195 @@
+package views
+
+import (
+	"bytes"
+	"container/ring"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/denandz/glorp/replay"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// pipelineModal - ask for a comma separated list of replay IDs to send over a single
+// connection. A "wait:<ms>" item pauses before sending the next request. The
+// connection is made to the first item's host, port and TLS settings
+func (view *ReplayView) pipelineModal(app *tview.Application) {
+	if _, ok := view.replays[view.id]; !ok {
+		return
+	}
+
+	stringModal(app, view.Layout, "Pipeline - IDs, wait:<ms>", view.id+","+view.id, func(s string) {
+		var steps []replay.PipelineStep
+		var methods []string
+		var dest *replay.Request
+		var wait time.Duration
+
+		for _, item := range strings.Split(s, ",") {
+			item = strings.TrimSpace(item)
+			if ms, ok := strings.CutPrefix(item, "wait:"); ok {
+				n, err := strconv.Atoi(ms)
+				if err != nil {
+					log.Printf("[!] ReplayView - pipeline - Bad wait %s\n", item)
+					return
+				}
+				wait += time.Duration(n) * time.Millisecond
+				continue
+			}
+
+			rr, ok := view.replays[item]
+			if !ok {
+				log.Printf("[!] ReplayView - pipeline - No replay item with ID %s\n", item)
+				return
+			}
+
+			r := rr.elements[rr.index].Copy()
+			if r.Protocol != replay.ProtoHTTP1 {
+				log.Printf("[!] ReplayView - pipeline - %s: %s\n", item, replay.ErrPipelineH2)
+				return
+			}
+			if view.updateContentLength.IsChecked() {
+				r.UpdateContentLength()
+			}
+			if dest == nil {
+				dest = &r
+			}
+
+			steps = append(steps, replay.PipelineStep{Raw: r.RawRequest, Wait: wait})
+			methods = append(methods, requestMethod(r.RawRequest))
+			wait = 0
+		}
+
+		if dest == nil {
+			return
+		}
+
+		view.goButton.SetLabel("Go - pipelining")
+		go func() {
+			stream, err := dest.SendPipeline(steps, 5*time.Second)
+			app.QueueUpdateDraw(func() {
+				view.goButton.SetLabel("Go")
+				if err != nil {
+					view.response.Clear()
+					fmt.Fprint(view.response, err)
+					return
+				}
+				view.showPipelineResults(app, stream, methods)
+			})
+		}()
+	})
+}
+
+// showPipelineResults - split the response stream into individual responses and show
+// them in a table. Leftover bytes, or a response count that doesn't match the number
+// of requests sent, are flagged in red
+func (view *ReplayView) showPipelineResults(app *tview.Application, stream []byte, methods []string) {
+	responses, leftover := replay.SplitResponses(stream, methods)
+
+	table := tview.NewTable()
+	table.SetFixed(1, 0)
+	table.SetBorders(false).SetSeparator(tview.Borders.Vertical)
+	table.SetSelectable(true, false)
+	table.SetBorder(true)
+	table.SetTitle(fmt.Sprintf("Pipeline - %d requests, %d responses", len(methods), len(responses)))
+	if len(responses) != len(methods) {
+		table.SetTitleColor(tcell.ColorRed)
+	}
+
+	table.SetCell(0, 0, tview.NewTableCell("#").SetTextColor(tcell.ColorMediumPurple).SetSelectable(false))
+	table.SetCell(0, 1, tview.NewTableCell("Offset").SetTextColor(tcell.ColorMediumPurple).SetSelectable(false))
+	table.SetCell(0, 2, tview.NewTableCell("Status").SetTextColor(tcell.ColorMediumPurple).SetSelectable(false))
+	table.SetCell(0, 3, tview.NewTableCell("Size").SetTextColor(tcell.ColorMediumPurple).SetSelectable(false).SetExpansion(1))
+
+	// each row maps to the bytes shown when it's selected
+	rows := [][]byte{stream}
+	table.SetCell(1, 0, tview.NewTableCell("Stream"))
+	table.SetCell(1, 1, tview.NewTableCell("0"))
+	table.SetCell(1, 2, tview.NewTableCell(""))
+	table.SetCell(1, 3, tview.NewTableCell(strconv.Itoa(len(stream))))
+
+	for i, res := range responses {
+		color := tcell.ColorDefault
+		if i >= len(methods) {
+			color = tcell.ColorRed // more responses than requests
+		}
+
+		n := table.GetRowCount()
+		table.SetCell(n, 0, tview.NewTableCell(strconv.Itoa(i+1)).SetTextColor(color))
+		table.SetCell(n, 1, tview.NewTableCell(strconv.Itoa(res.Offset)).SetTextColor(color))
+		table.SetCell(n, 2, tview.NewTableCell(strconv.Itoa(res.Status)).SetTextColor(color))
+		table.SetCell(n, 3, tview.NewTableCell(strconv.Itoa(len(res.Raw))).SetTextColor(color))
+		rows = append(rows, res.Raw)
+	}
+
+	if len(leftover) > 0 {
+		n := table.GetRowCount()
+		table.SetCell(n, 0, tview.NewTableCell("Leftover").SetTextColor(tcell.ColorRed))
+		table.SetCell(n, 1, tview.NewTableCell(strconv.Itoa(len(stream)-len(leftover))).SetTextColor(tcell.ColorRed))
+		table.SetCell(n, 2, tview.NewTableCell(""))
+		table.SetCell(n, 3, tview.NewTableCell(strconv.Itoa(len(leftover))).SetTextColor(tcell.ColorRed))
+		rows = append(rows, leftover)
+	}
+
+	response := NewTextPrimitive()
+	response.SetBorder(true)
+	response.SetTitle("Response")
+
+	table.SetSelectionChangedFunc(func(row int, column int) {
+		if row < 1 || row > len(rows) {
+			return
+		}
+
+		response.Clear()
+		fmt.Fprint(response, string(rows[row-1]))
+		fmt.Fprint(response, "\u2800")
+		response.ScrollToBeginning()
+	})
+
+	layout := tview.NewFlex()
+	layout.AddItem(table, 0, 1, true)
+	layout.AddItem(response, 0, 2, false)
+
+	r := ring.New(2)
+	r.Value = table
+	r = r.Next()
+	r.Value = response
+	r = r.Next()
+
+	layout.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyTab, tcell.KeyBacktab:
+			r = r.Next()
+			app.SetFocus(r.Value.(tview.Primitive))
+			return nil
+		case tcell.KeyCtrlS:
+			if row, _ := table.GetSelection(); row >= 1 && row <= len(rows) {
+				saveModal(app, view.Layout, rows[row-1])
+			}
+			return nil
+		case tcell.KeyESC:
+			view.Layout.HidePage("pipelinepage")
+			view.Layout.RemovePage("pipelinepage")
+			app.SetFocus(view.Table)
+			return nil
+		}
+		return event
+	})
+
+	view.Layout.AddPage("pipelinepage", layout, true, true)
+	app.SetFocus(table)
+	table.Select(1, 0)
+}
+
+// requestMethod - pull the method out of a raw HTTP request
+func requestMethod(raw []byte) string {
+	method, _, found := bytes.Cut(raw, []byte(" "))
+	if !found {
+		return ""
+	}
+	return string(method)
+}
@@ -33,8 +33,11 @@ type ProxyView struct {
 	Table       *tview.Table     // the proxy history table
 	requestBox  *TextPrimitive   // request text box
 	responseBox *TextPrimitive   // response text box
+	detailsBox  *tview.TextView  // connection details, toggled with ctrl-d
 	Logger      *modifier.Logger // the Martian logger
 
+	columns []bool // which of the optional connColumns are shown
+
 	filter ViewFilter // filter for the proxy view
 }
 
@@ -70,13 +73,8 @@ func (view *ProxyView) Init(app *tview.Application, replayview *ReplayView, logg
 	view.Table.SetSelectable(true, false)
 
 	// Set up the table headers
-	view.Table.SetCell(0, 1, tview.NewTableCell("ID").SetTextColor(tcell.ColorMediumPurple).SetSelectable(false).SetAlign(tview.AlignCenter))
-	view.Table.SetCell(0, 2, tview.NewTableCell("URL").SetTextColor(tcell.ColorMediumPurple).SetSelectable(false).SetAlign(tview.AlignCenter))
-	view.Table.SetCell(0, 3, tview.NewTableCell("Status").SetTextColor(tcell.ColorMediumPurple).SetSelectable(false))
-	view.Table.SetCell(0, 4, tview.NewTableCell("Size").SetTextColor(tcell.ColorMediumPurple).SetSelectable(false))
-	view.Table.SetCell(0, 5, tview.NewTableCell("Time").SetTextColor(tcell.ColorMediumPurple).SetSelectable(false))
-	view.Table.SetCell(0, 6, tview.NewTableCell("Date").SetTextColor(tcell.ColorMediumPurple).SetSelectable(false))
-	view.Table.SetCell(0, 7, tview.NewTableCell("Method").SetTextColor(tcell.ColorMediumPurple).SetSelectable(false))
+	view.columns = make([]bool, len(connColumns))
+	view.setHeaders()
 
 	reqRespFlexView := tview.NewFlex()
 	view.requestBox = NewTextPrimitive()
@@ -85,7 +83,7 @@ func (view *ProxyView) Init(app *tview.Application, replayview *ReplayView, logg
 	view.requestBox.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		if event.Key() == tcell.KeyCtrlS {
 			if entry := view.Logger.GetEntry(id); entry != nil {
-				saveModal(app, view.Layout, entry.Request.Raw)
+				saveModal(app, view.Layout, entry.Request.Full())
 			}
 		} else if event.Key() == tcell.KeyCtrlE {
 			if entry := view.Logger.GetEntry(id); entry != nil {
@@ -103,7 +101,7 @@ func (view *ProxyView) Init(app *tview.Application, replayview *ReplayView, logg
 					}
 					defer os.Remove(file.Name())
 
-					file.Write(entry.Request.Raw)
+					file.Write(entry.Request.Full())
 					file.Close()
 					cmd := exec.Command("/usr/bin/view", "-b", file.Name())
 					cmd.Stdout = os.Stdout
@@ -118,26 +116,13 @@ func (view *ProxyView) Init(app *tview.Application, replayview *ReplayView, logg
 			}
 		} else if event.Key() == tcell.KeyCtrlU {
 			if entry := view.Logger.GetEntry(id); entry != nil {
-				reader := bytes.NewReader(entry.Request.Raw)
-				req, err := http.ReadRequest(bufio.NewReader(reader))
-
+				req, err := parseExportRequest(entry.Request.Full())
 				if err != nil {
-					log.Printf("[!] Error copy-as-curl %s\n", err)
+					log.Printf("[!] Error exporting request %s\n", err)
 					return event
 				}
-
-				curlCmd := reqToCurl(req, entry.Request.URL)
-				if curlCmd != "" {
-					log.Println(curlCmd)
-
-					// Copy and pasting out of the log view is a pain due to word wrapping
-					// spit out the curl CMD on stderr as well so can read it from a
-					// 2> redirected output file
-					o, _ := os.Stderr.Stat()
-					if (o.Mode() & os.ModeCharDevice) != os.ModeCharDevice {
-						fmt.Fprintln(os.Stderr, curlCmd)
-					}
-				}
+				req.URL = entry.Request.URL
+				exportModal(app, view.Layout, view.requestBox, req, nil)
 			}
 		}
 		return event
@@ -149,7 +134,7 @@ func (view *ProxyView) Init(app *tview.Application, replayview *ReplayView, logg
 	view.responseBox.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		if event.Key() == tcell.KeyCtrlS {
 			if entry := view.Logger.GetEntry(id); entry != nil {
-				saveModal(app, view.Layout, entry.Response.Raw)
+				saveModal(app, view.Layout, entry.Response.Full())
 			}
 		} else if event.Key() == tcell.KeyCtrlE {
 			if entry := view.Logger.GetEntry(id); entry != nil {
@@ -167,7 +152,7 @@ func (view *ProxyView) Init(app *tview.Application, replayview *ReplayView, logg
 					}
 					defer os.Remove(file.Name())
 
-					file.Write(entry.Response.Raw)
+					file.Write(entry.Response.Full())
 					file.Close()
 					cmd := exec.Command("/usr/bin/view", "-b", file.Name())
 					cmd.Stdout = os.Stdout
@@ -185,6 +170,11 @@ func (view *ProxyView) Init(app *tview.Application, replayview *ReplayView, logg
 		return event
 	})
 
+	view.detailsBox = tview.NewTextView()
+	view.detailsBox.SetDynamicColors(true)
+	view.detailsBox.SetBorder(true)
+	view.detailsBox.SetTitle("Details")
+
 	reqRespFlexView.AddItem(view.requestBox, 0, 1, false)
 	reqRespFlexView.AddItem(view.responseBox, 0, 1, false)
 
@@ -246,10 +236,16 @@ func (view *ProxyView) Init(app *tview.Application, replayview *ReplayView, logg
 
 		view.requestBox.Clear()
 		view.responseBox.Clear()
+		view.responseBox.SetTitle("Response")
+		view.detailsBox.Clear()
 
 		// get the ID from the table
 		id = view.Table.GetCell(row, 1).Text
 		if entry := view.Logger.GetEntry(id); entry != nil {
+			if entry.Conn != nil && entry.Conn.RemoteAddr != "" {
+				view.responseBox.SetTitle("Response - " + entry.Conn.RemoteAddr)
+			}
+			view.detailsBox.SetText(connDetails(entry))
 			if entry.Request != nil {
 
 				view.writeRequest(entry)
@@ -334,6 +330,30 @@ func (view *ProxyView) Init(app *tview.Application, replayview *ReplayView, logg
 			focusRing = focusRing.Prev()
 			app.SetFocus(focusRing.Value.(tview.Primitive))
 
+		case tcell.KeyCtrlY:
+			if entry := view.Logger.GetEntry(id); entry != nil {
+				view.copyModal(app, entry)
+				return nil
+			}
+
+		case tcell.KeyCtrlT:
+			if entry := view.Logger.GetEntry(id); entry != nil {
+				certModal(app, view.Layout, app.GetFocus(), entry)
+				return nil
+			}
+
+		case tcell.KeyCtrlD:
+			if reqRespFlexView.GetItemCount() == 2 {
+				reqRespFlexView.AddItem(view.detailsBox, 40, 0, false)
+			} else {
+				reqRespFlexView.RemoveItem(view.detailsBox)
+			}
+			return nil
+
+		case tcell.KeyCtrlO:
+			view.columnsModal(app)
+			return nil
+
 		case tcell.KeyCtrlR:
 			if entry := view.Logger.GetEntry(id); entry != nil {
 				replayData := &replay.Request{}
@@ -347,13 +367,14 @@ func (view *ProxyView) Init(app *tview.Application, replayview *ReplayView, logg
 				// Parse the raw request and add a Connection: close header.
 				// We do this here instead of on request launch so that the user is
 				// free to edit the request in the replayer and remove the header
-				reader := bytes.NewReader(entry.Request.Raw)
+				raw := entry.Request.Full()
+				reader := bytes.NewReader(raw)
 				req, err := http.ReadRequest(bufio.NewReader(reader))
 
 				if err != nil {
 					log.Printf("Error: Issue in ReadRequest for request %s: %s\n", id, err)
-					replayData.RawRequest = make([]byte, len(entry.Request.Raw))
-					copy(replayData.RawRequest, entry.Request.Raw)
+					replayData.RawRequest = make([]byte, len(raw))
+					copy(replayData.RawRequest, raw)
 				} else {
 					req.Header.Set("Connection", "close")
 					replayData.RawRequest, err = httputil.DumpRequest(req, true)
@@ -361,8 +382,8 @@ func (view *ProxyView) Init(app *tview.Application, replayview *ReplayView, logg
 					if err != nil {
 						// fallback to the original request
 						log.Printf("Error: Issue in DumpRequest for request %s: %s\n", id, err)
-						replayData.RawRequest = make([]byte, len(entry.Request.Raw))
-						copy(replayData.RawRequest, entry.Request.Raw)
+						replayData.RawRequest = make([]byte, len(raw))
+						copy(replayData.RawRequest, raw)
 					}
 				}
 
@@ -443,6 +464,11 @@ func (view *ProxyView) AddEntry(e *modifier.Entry, t int) {
 				view.Table.SetCell(n, 2, tview.NewTableCell(url).SetExpansion(1))
 				view.Table.SetCell(n, 6, tview.NewTableCell(""))
 				view.Table.SetCell(n, 7, tview.NewTableCell(e.Request.Method))
+				view.Table.SetCell(n, 8, tview.NewTableCell(e.Tag))
+				if e.Blocked || e.Fault != "" {
+					view.Table.SetCell(n, 3, statusCell(e))
+				}
+				view.setConnColumns(n, e)
 
 			case 1: // response
 				// find the table row with the corresponding request. I expect responses to arrive relatively soon after the request
@@ -450,21 +476,30 @@ func (view *ProxyView) AddEntry(e *modifier.Entry, t int) {
 				if e.Response != nil {
 					for i := n; i > 0; i-- {
 						if i < n && view.Table.GetCell(i, 1).Text == e.ID {
-							view.Table.SetCell(i, 3, tview.NewTableCell(strconv.Itoa(e.Response.Status)))
-							view.Table.SetCell(i, 4, tview.NewTableCell(strconv.Itoa(len(e.Response.Raw))))
+							view.Table.SetCell(i, 3, statusCell(e))
+							view.Table.SetCell(i, 4, tview.NewTableCell(strconv.FormatInt(e.Response.Size(), 10)))
 							view.Table.SetCell(i, 5, tview.NewTableCell(strconv.FormatInt(e.Time, 10)))
 							view.Table.SetCell(i, 6, tview.NewTableCell(e.StartedDateTime.Format("02-01-2006 15:04:05")).SetAlign(tview.AlignRight))
+							if len(e.Findings) > 0 {
+								view.Table.GetCell(i, 2).SetTextColor(tcell.ColorRed)
+							}
+							view.setConnColumns(i, e)
 						}
 					}
 				}
 			case 2: // save/load
 				view.Table.SetCell(n, 1, tview.NewTableCell(e.ID))
 				view.Table.SetCell(n, 2, tview.NewTableCell(url).SetExpansion(1))
+				if len(e.Findings) > 0 {
+					view.Table.GetCell(n, 2).SetTextColor(tcell.ColorRed)
+				}
 				view.Table.SetCell(n, 6, tview.NewTableCell(""))
 				view.Table.SetCell(n, 7, tview.NewTableCell(e.Request.Method))
+				view.Table.SetCell(n, 8, tview.NewTableCell(e.Tag))
+				view.setConnColumns(n, e)
+				view.Table.SetCell(n, 3, statusCell(e))
 				if e.Response != nil {
-					view.Table.SetCell(n, 3, tview.NewTableCell(strconv.Itoa(e.Response.Status)))
-					view.Table.SetCell(n, 4, tview.NewTableCell(strconv.Itoa(len(e.Response.Raw))))
+					view.Table.SetCell(n, 4, tview.NewTableCell(strconv.FormatInt(e.Response.Size(), 10)))
 					view.Table.SetCell(n, 5, tview.NewTableCell(strconv.FormatInt(e.Time, 10)))
 					view.Table.SetCell(n, 6, tview.NewTableCell(e.StartedDateTime.Format("02-01-2006 15:04:05")).SetAlign(tview.AlignRight))
 				}
@@ -473,6 +508,29 @@ func (view *ProxyView) AddEntry(e *modifier.Entry, t int) {
 	}
 }
 
+// statusCell - the status column for an entry. Entries stopped by a block rule are shown
+// in orange, and entries a network rule injected a failure into in yellow. Entries
+// without a response say Blocked when they were dropped, and Reset when they were reset
+func statusCell(e *modifier.Entry) *tview.TableCell {
+	text := ""
+	switch {
+	case e.Response != nil:
+		text = strconv.Itoa(e.Response.Status)
+	case e.Blocked:
+		text = "Blocked"
+	case e.Fault != "":
+		text = "Reset"
+	}
+
+	cell := tview.NewTableCell(text)
+	if e.Blocked {
+		cell.SetTextColor(tcell.ColorOrange)
+	} else if e.Fault != "" {
+		cell.SetTextColor(tcell.ColorYellow)
+	}
+	return cell
+}
+
 // proxyfilter should take a URL, evaluate the filters and return true if the proxy entry should be displayed
 // or false if the response entry should not be displayed
 func (view *ProxyView) proxyfilter(url string) bool {
@@ -492,10 +550,8 @@ func (view *ProxyView) proxyfilter(url string) bool {
 	}
 }
 
-// reloadtable clears the proxy table and redraws, happens when changing the filter regex
-func (view *ProxyView) reloadtable() {
-	view.Table.Clear()
-
+// setHeaders - the header row, the fixed columns followed by the enabled optional ones
+func (view *ProxyView) setHeaders() {
 	view.Table.SetCell(0, 1, tview.NewTableCell("ID").SetTextColor(tcell.ColorMediumPurple).SetSelectable(false).SetAlign(tview.AlignCenter))
 	view.Table.SetCell(0, 2, tview.NewTableCell("URL").SetTextColor(tcell.ColorMediumPurple).SetSelectable(false).SetAlign(tview.AlignCenter))
 	view.Table.SetCell(0, 3, tview.NewTableCell("Status").SetTextColor(tcell.ColorMediumPurple).SetSelectable(false))
@@ -503,6 +559,21 @@ func (view *ProxyView) reloadtable() {
 	view.Table.SetCell(0, 5, tview.NewTableCell("Time").SetTextColor(tcell.ColorMediumPurple).SetSelectable(false))
 	view.Table.SetCell(0, 6, tview.NewTableCell("Date").SetTextColor(tcell.ColorMediumPurple).SetSelectable(false))
 	view.Table.SetCell(0, 7, tview.NewTableCell("Method").SetTextColor(tcell.ColorMediumPurple).SetSelectable(false))
+	view.Table.SetCell(0, 8, tview.NewTableCell("Tag").SetTextColor(tcell.ColorMediumPurple).SetSelectable(false))
+
+	col := firstConnColumn
+	for i, c := range connColumns {
+		if view.columns[i] {
+			view.Table.SetCell(0, col, tview.NewTableCell(c.name).SetTextColor(tcell.ColorMediumPurple).SetSelectable(false))
+			col++
+		}
+	}
+}
+
+// reloadtable clears the proxy table and redraws, happens when changing the filter regex
+func (view *ProxyView) reloadtable() {
+	view.Table.Clear()
+	view.setHeaders()
 
 	var proxyentries []*modifier.Entry
 	for _, value := range view.Logger.GetEntries() {
@@ -530,7 +601,7 @@ func (view *ProxyView) writeRequest(e *modifier.Entry) {
 
 	switch e.Source {
 	case modifier.SourceBrowser:
-		fmt.Fprintf(view.requestBox, string(e.Request.Raw))
+		fmt.Fprint(view.requestBox, string(e.Request.Raw))
 		fmt.Fprint(view.requestBox, "\u2800")
 	default:
 		mv := messageview.New()
@@ -563,6 +634,20 @@ func (view *ProxyView) writeResponse(e *modifier.Entry) {
 		return
 	}
 
+	// a body that was spilled to disk or cut short by the capture limit isn't all in Raw
+	if e.Response.BodyFile != "" || e.Response.Truncated {
+		fmt.Fprint(view.responseBox, string(messageHead(e.Response.Raw)))
+		fmt.Fprintf(view.responseBox, "\r\n\r\nResponse body of %d bytes not shown", e.Response.BodySize)
+		if e.Response.Truncated {
+			fmt.Fprint(view.responseBox, ", it was truncated by the capture limit")
+		}
+		if e.Response.BodyFile != "" {
+			fmt.Fprintf(view.responseBox, " - captured body in %s, CTRL-E or CTRL-S", e.Response.BodyFile)
+		}
+		fmt.Fprint(view.responseBox, "\u2800")
+		return
+	}
+
 	// if the response greater than 5 megabytes, just display the headers
 	if len(e.Response.Raw) > 5*1024*1024 {
 		crlf := strings.Index(string(e.Response.Raw), "\r\n\r\n")
@@ -580,7 +665,7 @@ func (view *ProxyView) writeResponse(e *modifier.Entry) {
 
 	switch e.Source {
 	case modifier.SourceBrowser:
-		fmt.Fprintf(view.responseBox, string(e.Response.Raw))
+		fmt.Fprint(view.responseBox, string(e.Response.Raw))
 		fmt.Fprint(view.responseBox, "\u2800")
 	default:
 		reader := bytes.NewReader(e.Response.Raw)
@@ -613,3 +698,31 @@ func (view *ProxyView) writeResponse(e *modifier.Entry) {
 		fmt.Fprint(view.responseBox, "\u2800")
 	}
 }
+
+// copyModal - show the copy menu for a proxy entry
+func (view *ProxyView) copyModal(app *tview.Application, entry *modifier.Entry) {
+	response := func() []byte {
+		if entry.Response == nil {
+			return nil
+		}
+		return entry.Response.Full()
+	}
+
+	items := []copyItem{
+		{"URL", func() []byte { return []byte(entry.Request.URL) }},
+		{"Raw request", func() []byte { return entry.Request.Full() }},
+		{"Raw response", response},
+		{"Request body", func() []byte { return messageBody(entry.Request.Full()) }},
+		{"Response body", func() []byte { return messageBody(response()) }},
+		{"Certificate chain", func() []byte { return chainPEM(entry) }},
+	}
+
+	req, err := parseExportRequest(entry.Request.Full())
+	if err == nil {
+		req.URL = entry.Request.URL
+	} else {
+		req = nil
+	}
+
+	copyModal(app, view.Layout, app.GetFocus(), items, req)
+}
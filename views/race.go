@@ -0,0 +1,167 @@
+package views
+
+import (
+	"bytes"
+	"container/ring"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/denandz/glorp/replay"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// maxRace - the most copies of a request a race sends. Every one holds a connection
+// open until the release, in the same process as the proxy
+const maxRace = 250
+
+// raceModal - ask for either a number of copies of the current request, or a comma
+// separated list of replay IDs, then fire them all at once
+func (view *ReplayView) raceModal(app *tview.Application) {
+	if _, ok := view.replays[view.id]; !ok {
+		return
+	}
+
+	stringModal(app, view.Layout, "Race - count or IDs", "10", func(s string) {
+		var reqs []*replay.Request
+		updateCL := view.updateContentLength.IsChecked()
+
+		if n, err := strconv.Atoi(strings.TrimSpace(s)); err == nil {
+			if n < 1 || n > maxRace {
+				log.Printf("[!] ReplayView - race - Count %d out of range, use 1 to %d\n", n, maxRace)
+				return
+			}
+			rr := view.replays[view.id]
+			for i := 0; i < n; i++ {
+				r := rr.elements[rr.index].Copy()
+				reqs = append(reqs, &r)
+			}
+		} else {
+			for _, id := range strings.Split(s, ",") {
+				rr, ok := view.replays[strings.TrimSpace(id)]
+				if !ok {
+					log.Printf("[!] ReplayView - race - No replay item with ID %s\n", id)
+					return
+				}
+				r := rr.elements[rr.index].Copy()
+				reqs = append(reqs, &r)
+			}
+		}
+
+		if len(reqs) == 0 {
+			return
+		}
+
+		for _, r := range reqs {
+			r.RawResponse = nil
+			r.ResponseTime = ""
+			if updateCL {
+				r.UpdateContentLength()
+			}
+		}
+
+		view.goButton.SetLabel("Go - racing")
+		go func() {
+			results := replay.SendRace(reqs)
+			app.QueueUpdateDraw(func() {
+				view.goButton.SetLabel("Go")
+				view.showRaceResults(app, results)
+			})
+		}()
+	})
+}
+
+// showRaceResults - display a table of race results, selecting a row shows its response
+func (view *ReplayView) showRaceResults(app *tview.Application, results []replay.RaceResult) {
+	table := tview.NewTable()
+	table.SetFixed(1, 0)
+	table.SetBorders(false).SetSeparator(tview.Borders.Vertical)
+	table.SetSelectable(true, false)
+	table.SetBorder(true)
+	table.SetTitle("Race Results")
+
+	table.SetCell(0, 0, tview.NewTableCell("#").SetTextColor(tcell.ColorMediumPurple).SetSelectable(false))
+	table.SetCell(0, 1, tview.NewTableCell("ID").SetTextColor(tcell.ColorMediumPurple).SetSelectable(false))
+	table.SetCell(0, 2, tview.NewTableCell("Status").SetTextColor(tcell.ColorMediumPurple).SetSelectable(false))
+	table.SetCell(0, 3, tview.NewTableCell("Size").SetTextColor(tcell.ColorMediumPurple).SetSelectable(false))
+	table.SetCell(0, 4, tview.NewTableCell("Offset").SetTextColor(tcell.ColorMediumPurple).SetSelectable(false))
+	table.SetCell(0, 5, tview.NewTableCell("Time").SetTextColor(tcell.ColorMediumPurple).SetSelectable(false).SetExpansion(1))
+
+	for i, res := range results {
+		status := responseStatus(res.Response)
+		if res.Err != nil {
+			status = "ERROR"
+		}
+
+		table.SetCell(i+1, 0, tview.NewTableCell(strconv.Itoa(i+1)))
+		table.SetCell(i+1, 1, tview.NewTableCell(res.Request.ID))
+		table.SetCell(i+1, 2, tview.NewTableCell(status))
+		table.SetCell(i+1, 3, tview.NewTableCell(strconv.Itoa(len(res.Response))))
+		table.SetCell(i+1, 4, tview.NewTableCell(res.Offset.String()))
+		table.SetCell(i+1, 5, tview.NewTableCell(res.Duration.String()))
+	}
+
+	response := NewTextPrimitive()
+	response.SetBorder(true)
+	response.SetTitle("Response")
+
+	table.SetSelectionChangedFunc(func(row int, column int) {
+		if row < 1 || row > len(results) {
+			return
+		}
+
+		res := results[row-1]
+		response.Clear()
+		if res.Err != nil {
+			fmt.Fprint(response, res.Err)
+		} else {
+			fmt.Fprint(response, string(res.Response))
+		}
+		fmt.Fprint(response, "\u2800")
+		response.ScrollToBeginning()
+	})
+
+	layout := tview.NewFlex()
+	layout.AddItem(table, 0, 1, true)
+	layout.AddItem(response, 0, 2, false)
+
+	r := ring.New(2)
+	r.Value = table
+	r = r.Next()
+	r.Value = response
+	r = r.Next()
+
+	layout.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyTab, tcell.KeyBacktab:
+			r = r.Next()
+			app.SetFocus(r.Value.(tview.Primitive))
+			return nil
+		case tcell.KeyESC:
+			view.Layout.HidePage("racepage")
+			view.Layout.RemovePage("racepage")
+			app.SetFocus(view.Table)
+			return nil
+		}
+		return event
+	})
+
+	view.Layout.AddPage("racepage", layout, true, true)
+	app.SetFocus(table)
+	if len(results) > 0 {
+		table.Select(1, 0)
+	}
+}
+
+// responseStatus - pull the status code out of a raw HTTP response
+func responseStatus(raw []byte) string {
+	line, _, _ := bytes.Cut(raw, []byte("\n"))
+	fields := strings.Fields(string(line))
+	if len(fields) < 2 {
+		return ""
+	}
+	return fields[1]
+}
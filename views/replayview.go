@@ -33,6 +33,7 @@ type ReplayView struct {
 	host                *tview.InputField // host field input
 	port                *tview.InputField // port input
 	tls                 *tview.Checkbox   // check box for whether or not to negotiate TLS when rep
+	proto               *tview.DropDown   // protocol used to send the request, HTTP/1, HTTP/2 or h2c upgrade
 	updateContentLength *tview.Checkbox   // check box for whether to attempt a content-length auto update
 	externalEditor      *tview.Checkbox   // check box to use an external editor for the request, auto-fire on change
 	autoSend            *tview.Checkbox   // check box to deermine if modified requests should be auto-sent
@@ -40,6 +41,8 @@ type ReplayView struct {
 	id string // id of the currently selected replay item
 
 	replays map[string]*ReplayRequests // list of request in the replayer - could probably use the row identifier as the key, support renaming
+	chains  map[string]*replay.Chain   // request chains, keyed by name
+	chain   string                     // name of the last chain that was edited or run
 }
 
 // ReplayRequests - hold an array of requests for a replay item and the currently selected array ID
@@ -139,28 +142,36 @@ func updateRawRequest(rr *ReplayRequests, r *replay.Request, data []byte) (req *
 	defer rr.mu.Unlock()
 
 	if len(r.RawResponse) > 0 {
-		new_request := r.Copy()
-		new_request.RawResponse = nil
-		new_request.ResponseTime = ""
-		new_request.RawRequest = data
-
-		// Copy() ignores these pointers, manually move them across
-		new_request.ExternalFile = r.ExternalFile
-		new_request.Watcher = r.Watcher
-		r.ExternalFile = nil
-		r.Watcher = nil
-
-		rr.elements = append(rr.elements, &new_request)
-		rr.index = len(rr.elements) - 1
-		req = &new_request
+		req = nextElement(rr, r)
 	} else {
-		r.RawRequest = data
 		req = r
 	}
+	req.RawRequest = data
+	req.Template = nil
 
 	return
 }
 
+// nextElement - add a copy of r without its response to the end of the history and
+// select it, so a change to the request doesn't rewrite what was sent. Callers hold rr.mu
+func nextElement(rr *ReplayRequests, r *replay.Request) *replay.Request {
+	new_request := r.Copy()
+	new_request.RawResponse = nil
+	new_request.ResponseTime = ""
+	new_request.Frames = ""
+	new_request.TLSState = nil
+
+	// Copy() ignores these pointers, manually move them across
+	new_request.ExternalFile = r.ExternalFile
+	new_request.Watcher = r.Watcher
+	r.ExternalFile = nil
+	r.Watcher = nil
+
+	rr.elements = append(rr.elements, &new_request)
+	rr.index = len(rr.elements) - 1
+	return &new_request
+}
+
 // externalEditor - called when the user toggles the external editor checkbox
 // If enabled, creates a goroutine to monitor an external file that is used
 // to update the request as it's loaded
@@ -275,9 +286,13 @@ func (view *ReplayView) GetView() (title string, content tview.Primitive) {
 // Init - Initialization method for the replayer view
 func (view *ReplayView) Init(app *tview.Application) {
 	view.replays = make(map[string]*ReplayRequests)
+	view.chains = make(map[string]*replay.Chain)
 	view.responseMeta = tview.NewTable()
 	view.responseMeta.SetCell(0, 0, tview.NewTableCell("Size:").SetTextColor(tcell.ColorMediumPurple))
 	view.responseMeta.SetCell(0, 2, tview.NewTableCell("Time:").SetTextColor(tcell.ColorMediumPurple))
+	view.responseMeta.SetCell(1, 0, tview.NewTableCell("TLS:").SetTextColor(tcell.ColorMediumPurple))
+	view.responseMeta.SetCell(1, 2, tview.NewTableCell("ALPN:").SetTextColor(tcell.ColorMediumPurple))
+	view.responseMeta.SetCell(0, 4, tview.NewTableCell("IP:").SetTextColor(tcell.ColorMediumPurple))
 
 	//view.Layout = tview.NewFlex()
 	view.Layout = tview.NewPages()
@@ -347,6 +362,16 @@ func (view *ReplayView) Init(app *tview.Application) {
 		}
 	})
 
+	view.proto = tview.NewDropDown()
+	view.proto.SetLabelColor(tcell.ColorMediumPurple)
+	view.proto.SetLabel("Proto ")
+	view.proto.SetOptions(protoNames, nil)
+	view.proto.SetSelectedFunc(func(text string, index int) {
+		if rr, ok := view.replays[view.id]; ok {
+			view.setProtocol(rr, protoValues[index])
+		}
+	})
+
 	view.updateContentLength = tview.NewCheckbox().SetChecked(true)
 	view.updateContentLength.SetLabelColor(tcell.ColorMediumPurple)
 	view.updateContentLength.SetLabel("Update CL")
@@ -397,8 +422,9 @@ func (view *ReplayView) Init(app *tview.Application) {
 		case tcell.KeyCtrlE:
 			if rr, ok := view.replays[view.id]; ok && !view.externalEditor.IsChecked() {
 				if runtime.GOOS == "windows" {
-					log.Println("[!] Built-in editors are not supported under windows yet")
-					return event
+					// vi isn't available, fall back to the built-in editor
+					view.editorPage(app, rr)
+					return nil
 				}
 
 				app.EnableMouse(false)
@@ -439,6 +465,12 @@ func (view *ReplayView) Init(app *tview.Application) {
 				app.EnableMouse(true)
 			}
 
+		case tcell.KeyEnter:
+			if rr, ok := view.replays[view.id]; ok && !view.externalEditor.IsChecked() {
+				view.editorPage(app, rr)
+				return nil
+			}
+
 		case tcell.KeyCtrlS:
 			if req, ok := view.replays[view.id]; ok {
 				saveModal(app, view.Layout, req.elements[req.index].RawRequest)
@@ -496,6 +528,7 @@ func (view *ReplayView) Init(app *tview.Application) {
 
 	formTopRow := tview.NewFlex()
 	formTopRow.AddItem(view.host, 0, 7, false).AddItem(view.port, 0, 2, false).AddItem(view.tls, 0, 1, false)
+	formTopRow.AddItem(view.proto, 0, 2, false)
 	formBottomRow := tview.NewFlex().AddItem(view.updateContentLength, 0, 1, false)
 	formBottomRow.AddItem(view.externalEditor, 0, 1, false)
 	formBottomRow.AddItem(view.autoSend, 0, 1, false)
@@ -526,6 +559,7 @@ func (view *ReplayView) Init(app *tview.Application) {
 		view.host,
 		view.port,
 		view.tls,
+		view.proto,
 		view.updateContentLength,
 		view.externalEditor,
 		view.autoSend,
@@ -590,6 +624,43 @@ func (view *ReplayView) Init(app *tview.Application) {
 
 		case tcell.KeyCtrlG:
 			view.sendRequest(app, view.id)
+
+		case tcell.KeyCtrlK:
+			view.chainModal(app)
+
+		case tcell.KeyCtrlT:
+			view.raceModal(app)
+
+		case tcell.KeyCtrlW:
+			view.pipelineModal(app)
+
+		case tcell.KeyCtrlO:
+			view.optionsModal(app)
+
+		case tcell.KeyCtrlA:
+			view.importModal(app)
+
+		case tcell.KeyCtrlY:
+			view.copyModal(app)
+
+		case tcell.KeyCtrlU:
+			if rr, ok := view.replays[view.id]; ok {
+				r := rr.elements[rr.index]
+				req, err := parseExportRequest(r.RawRequest)
+				if err != nil {
+					log.Printf("[!] ReplayView - export - %s\n", err)
+					break
+				}
+				req.URL = replayURL(r, req.Target)
+				exportModal(app, view.Layout, view.Table, req, nil)
+			}
+
+		case tcell.KeyCtrlL:
+			if c, ok := view.chains[view.chain]; ok {
+				view.runChain(app, c)
+			} else {
+				view.chainModal(app)
+			}
 		}
 		return event
 	})
@@ -604,10 +675,19 @@ func (view *ReplayView) refreshReplay(rr *ReplayRequests) {
 	view.host.SetText(rr.elements[rr.index].Host)
 	view.port.SetText(rr.elements[rr.index].Port)
 	view.tls.SetChecked(rr.elements[rr.index].TLS)
+	view.proto.SetCurrentOption(protoIndex(rr.elements[rr.index].Protocol))
 	view.history.SetText(strconv.Itoa(rr.index + 1))
 
 	fmt.Fprint(view.request, string(rr.elements[rr.index].RawRequest))
 	fmt.Fprint(view.response, string(rr.elements[rr.index].RawResponse))
+	if rr.elements[rr.index].Frames != "" {
+		fmt.Fprint(view.response, "\n\n---- frames ----\n")
+		fmt.Fprint(view.response, rr.elements[rr.index].Frames)
+	}
+	if state := rr.elements[rr.index].TLSState; state != nil {
+		fmt.Fprint(view.response, "\n\n---- tls ----\n")
+		fmt.Fprint(view.response, state.String())
+	}
 
 	// if an external file exists, show it in the request title
 	if rr.elements[rr.index].ExternalFile != nil {
@@ -630,6 +710,19 @@ func (view *ReplayView) refreshReplay(rr *ReplayRequests) {
 
 	view.responseMeta.SetCell(0, 1, tview.NewTableCell(strconv.Itoa(len(rr.elements[rr.index].RawResponse))))
 	view.responseMeta.SetCell(0, 3, tview.NewTableCell(rr.elements[rr.index].ResponseTime))
+	view.responseMeta.SetCell(0, 5, tview.NewTableCell(rr.elements[rr.index].RemoteAddr))
+
+	if state := rr.elements[rr.index].TLSState; state != nil {
+		cell := tview.NewTableCell(state.Version + " " + state.CipherSuite)
+		if state.Verify != "" && state.Verify != "ok" {
+			cell.SetText(cell.Text + " (untrusted)").SetTextColor(tcell.ColorRed)
+		}
+		view.responseMeta.SetCell(1, 1, cell)
+		view.responseMeta.SetCell(1, 3, tview.NewTableCell(state.ALPN))
+	} else {
+		view.responseMeta.SetCell(1, 1, tview.NewTableCell(""))
+		view.responseMeta.SetCell(1, 3, tview.NewTableCell(""))
+	}
 }
 
 // Send the request - save the response as a new entry
@@ -663,6 +756,7 @@ func (view *ReplayView) sendRequest(app *tview.Application, id string) {
 				} else {
 					view.responseMeta.SetCell(0, 1, tview.NewTableCell("ERROR"))
 					view.responseMeta.SetCell(0, 3, tview.NewTableCell("ERROR"))
+					view.responseMeta.SetCell(0, 5, tview.NewTableCell(req.RemoteAddr))
 					view.response.Clear()
 					fmt.Fprint(view.response, err)
 				}
@@ -693,3 +787,31 @@ func (view *ReplayView) sendRequest(app *tview.Application, id string) {
 		}()
 	}
 }
+
+// copyModal - show the copy menu for the selected replay item
+func (view *ReplayView) copyModal(app *tview.Application) {
+	rr, ok := view.replays[view.id]
+	if !ok {
+		return
+	}
+	r := rr.elements[rr.index]
+
+	req, err := parseExportRequest(r.RawRequest)
+	url := ""
+	if err == nil {
+		url = replayURL(r, req.Target)
+		req.URL = url
+	} else {
+		req = nil
+	}
+
+	items := []copyItem{
+		{"URL", func() []byte { return []byte(url) }},
+		{"Raw request", func() []byte { return r.RawRequest }},
+		{"Raw response", func() []byte { return r.RawResponse }},
+		{"Request body", func() []byte { return messageBody(r.RawRequest) }},
+		{"Response body", func() []byte { return messageBody(r.RawResponse) }},
+	}
+
+	copyModal(app, view.Layout, view.Table, items, req)
+}
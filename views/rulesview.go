@@ -0,0 +1,228 @@
+package views
+
+import (
+	"log"
+
+	"github.com/denandz/glorp/dialer"
+	"github.com/denandz/glorp/modifier"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// RulesView - edit the rules that change how the proxy and replayer connect, and
+// where the proxy sends requests
+type RulesView struct {
+	Layout *tview.Pages
+	tables []*ruleTable
+}
+
+// ruleTable - a table of pattern and value rules, with the functions to list and edit them
+type ruleTable struct {
+	*tview.Table
+	name    string    // shown in the table and modal titles
+	columns [2]string // pattern and value column names
+
+	list   func() [][2]string
+	set    func(pattern, value string) error
+	remove func(pattern string)
+	move   func(pattern string, by int) // nil for tables where order doesn't matter
+}
+
+// GetView - should return a title and the top-level primitive
+func (view *RulesView) GetView() (title string, content tview.Primitive) {
+	return "Rules", view.Layout
+}
+
+// Init - Initialize the rules view
+func (view *RulesView) Init(app *tview.Application) {
+	view.Layout = tview.NewPages()
+	mainLayout := tview.NewFlex().SetDirection(tview.FlexRow)
+
+	view.tables = []*ruleTable{
+		{
+			name:    "Hosts",
+			columns: [2]string{"Pattern", "IP"},
+			list: func() [][2]string {
+				var rows [][2]string
+				for _, o := range dialer.Hosts.List() {
+					rows = append(rows, [2]string{o.Pattern, o.IP})
+				}
+				return rows
+			},
+			set:    dialer.Hosts.Set,
+			remove: dialer.Hosts.Remove,
+		},
+		{
+			name:    "Routes",
+			columns: [2]string{"Pattern", "Action"},
+			list: func() [][2]string {
+				var rows [][2]string
+				for _, r := range dialer.Routing.List() {
+					rows = append(rows, [2]string{r.Pattern, r.Action})
+				}
+				return rows
+			},
+			set:    dialer.Routing.Set,
+			remove: dialer.Routing.Remove,
+			move:   dialer.Routing.Move,
+		},
+		mapTable("Block", "Action", modifier.Blocks),
+		mapTable("Map Local", "File", modifier.MapLocal),
+		mapTable("Map Remote", "URL", modifier.MapRemote),
+		mapTable("Network", "Conditions", modifier.Network),
+	}
+
+	for i, t := range view.tables {
+		t.Table = tview.NewTable()
+		t.SetBorder(true)
+		t.SetTitle(t.name)
+		t.SetFixed(1, 0)
+		t.SetSelectable(true, false)
+		t.SetSeparator(tview.Borders.Vertical)
+		for c, name := range t.columns {
+			t.SetCell(0, c, tview.NewTableCell(name).SetTextColor(tcell.ColorMediumPurple).SetSelectable(false))
+		}
+		t.reload()
+
+		next := view.tables[(i+1)%len(view.tables)]
+		t.SetInputCapture(view.tableInput(app, t, next))
+
+		mainLayout.AddItem(t, 0, 1, i == 0)
+	}
+
+	view.Layout.AddPage("rules", mainLayout, true, true)
+}
+
+// tableInput - the key handler for a rules table, Tab moves on to next
+func (view *RulesView) tableInput(app *tview.Application, t *ruleTable, next *ruleTable) func(event *tcell.EventKey) *tcell.EventKey {
+	return func(event *tcell.EventKey) *tcell.EventKey {
+		row, _ := t.GetSelection()
+		selected := row > 0 && row < t.GetRowCount()
+
+		switch event.Key() {
+		case tcell.KeyTab:
+			app.SetFocus(next)
+			return nil
+
+		case tcell.KeyCtrlB:
+			view.ruleModal(app, t, "", "")
+			return nil
+
+		case tcell.KeyEnter:
+			if selected {
+				view.ruleModal(app, t, t.GetCell(row, 0).Text, t.GetCell(row, 1).Text)
+			}
+			return nil
+
+		case tcell.KeyCtrlD:
+			if selected {
+				pattern := t.GetCell(row, 0).Text
+				boolModal(app, view.Layout, "Delete "+pattern+"?", func(b bool) {
+					if b {
+						t.remove(pattern)
+						t.reload()
+					}
+					app.SetFocus(t)
+				})
+			}
+			return nil
+
+		case tcell.KeyCtrlK, tcell.KeyCtrlJ:
+			if selected && t.move != nil {
+				by := -1
+				if event.Key() == tcell.KeyCtrlJ {
+					by = 1
+				}
+				t.move(t.GetCell(row, 0).Text, by)
+				t.reload()
+				t.Select(min(max(row+by, 1), t.GetRowCount()-1), 0)
+			}
+			return nil
+		}
+
+		return event
+	}
+}
+
+// mapTable - a table for one of the modifier's URL pattern rule tables, such as the
+// block, map and network rules
+func mapTable(name, column string, rules *modifier.Rules) *ruleTable {
+	return &ruleTable{
+		name:    name,
+		columns: [2]string{"Pattern", column},
+		list: func() [][2]string {
+			var rows [][2]string
+			for _, r := range rules.List() {
+				rows = append(rows, [2]string{r.Pattern, r.Value})
+			}
+			return rows
+		},
+		set:    rules.Set,
+		remove: rules.Remove,
+		move:   rules.Move,
+	}
+}
+
+// reload - refill the table from its rules
+func (t *ruleTable) reload() {
+	for t.GetRowCount() > 1 {
+		t.RemoveRow(1)
+	}
+
+	for i, r := range t.list() {
+		t.SetCell(i+1, 0, tview.NewTableCell(r[0]).SetExpansion(1))
+		t.SetCell(i+1, 1, tview.NewTableCell(r[1]).SetExpansion(1))
+	}
+}
+
+// ruleModal - add or edit a rule. pattern is empty for a new one
+func (view *RulesView) ruleModal(app *tview.Application, t *ruleTable, pattern, value string) {
+	form := tview.NewForm()
+	form.SetBorder(true)
+	form.SetTitle(t.name)
+	form.SetLabelColor(tcell.ColorMediumPurple)
+
+	newPattern, newValue := pattern, value
+	form.AddInputField(t.columns[0], pattern, 40, nil, func(text string) {
+		newPattern = text
+	})
+	form.AddInputField(t.columns[1], value, 40, nil, func(text string) {
+		newValue = text
+	})
+
+	closeModal := func() {
+		view.Layout.HidePage("rulemodal")
+		view.Layout.RemovePage("rulemodal")
+		app.SetFocus(t)
+	}
+
+	form.AddButton("Save", func() {
+		if err := t.set(newPattern, newValue); err != nil {
+			log.Printf("[!] RulesView - %s - %s\n", t.name, err)
+			notifModal(app, view.Layout, err.Error())
+			return
+		}
+		if pattern != "" && pattern != newPattern {
+			// a renamed rule keeps its place in ordered tables
+			if t.move != nil {
+				rows := t.list()
+				for i, r := range rows {
+					if r[0] == pattern {
+						t.move(newPattern, i-len(rows)+1)
+						break
+					}
+				}
+			}
+			t.remove(pattern)
+		}
+		t.reload()
+		closeModal()
+	})
+	form.AddButton("Cancel", closeModal)
+
+	form.SetCancelFunc(closeModal)
+
+	view.Layout.AddPage("rulemodal", newmodal(form, 56, 9), true, true)
+	app.SetFocus(form)
+}
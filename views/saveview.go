@@ -9,6 +9,7 @@ import (
 
 	"github.com/denandz/glorp/modifier"
 	"github.com/denandz/glorp/replay"
+	"github.com/denandz/glorp/scanner"
 
 	"github.com/rivo/tview"
 )
@@ -23,6 +24,8 @@ type savefile struct {
 	Replays      []ReplaySaves
 	Proxyentries []modifier.Entry
 	WebSocket    []modifier.WebSocketEntry `json:",omitempty"`
+	Chains       []replay.Chain            `json:",omitempty"`
+	Issues       []scanner.Issue           `json:",omitempty"`
 }
 
 // old style save file
@@ -44,7 +47,7 @@ func (view *SaveRestoreView) GetView() (title string, content tview.Primitive) {
 }
 
 // Init - Initialize the save view
-func (view *SaveRestoreView) Init(app *tview.Application, replays *ReplayView, proxy *ProxyView, sitemap *SiteMapView, websocket *WebSocketView) {
+func (view *SaveRestoreView) Init(app *tview.Application, replays *ReplayView, proxy *ProxyView, sitemap *SiteMapView, websocket *WebSocketView, issues *IssuesView) {
 	view.Layout = tview.NewPages()
 	var msg string
 
@@ -58,7 +61,7 @@ func (view *SaveRestoreView) Init(app *tview.Application, replays *ReplayView, p
 	form.AddButton("Save", func() {
 		_, err := os.Stat(filename.GetText())
 		if os.IsNotExist(err) { // need to check if dir
-			if Save(filename.GetText(), replays, proxy, websocket) {
+			if Save(filename.GetText(), replays, proxy, websocket, issues) {
 				msg = "Save Complete"
 			} else {
 				msg = "Save Failed"
@@ -67,7 +70,7 @@ func (view *SaveRestoreView) Init(app *tview.Application, replays *ReplayView, p
 		} else {
 			boolModal(app, view.Layout, "File exists - overwrite?", func(b bool) {
 				if b {
-					if !Save(filename.GetText(), replays, proxy, websocket) {
+					if !Save(filename.GetText(), replays, proxy, websocket, issues) {
 						log.Println("[!] Error: Save failed")
 					}
 				}
@@ -75,7 +78,7 @@ func (view *SaveRestoreView) Init(app *tview.Application, replays *ReplayView, p
 		}
 	})
 	form.AddButton("Load", func() {
-		if Load(filename.GetText(), replays, proxy, sitemap, websocket) {
+		if Load(filename.GetText(), replays, proxy, sitemap, websocket, issues) {
 			msg = "Loaded"
 		} else {
 			msg = "Load failed"
@@ -87,7 +90,7 @@ func (view *SaveRestoreView) Init(app *tview.Application, replays *ReplayView, p
 }
 
 // Save - spool the replay and proxy state off to a file
-func Save(filename string, replayview *ReplayView, proxy *ProxyView, websocket *WebSocketView) bool {
+func Save(filename string, replayview *ReplayView, proxy *ProxyView, websocket *WebSocketView, issues *IssuesView) bool {
 	if filename == "" {
 		return false
 	}
@@ -111,7 +114,8 @@ func Save(filename string, replayview *ReplayView, proxy *ProxyView, websocket *
 
 	var proxyentries []modifier.Entry
 	for _, value := range proxy.Logger.GetEntries() {
-		proxyentries = append(proxyentries, *value)
+		// spilled bodies go in the file, their temp files are removed on exit
+		proxyentries = append(proxyentries, value.Inlined())
 	}
 
 	// sort proxyentries by date
@@ -131,11 +135,26 @@ func Save(filename string, replayview *ReplayView, proxy *ProxyView, websocket *
 		})
 	}
 
+	var chains []replay.Chain
+	for _, v := range replayview.chains {
+		chains = append(chains, *v)
+	}
+	sort.Slice(chains, func(i, j int) bool {
+		return chains[i].Name < chains[j].Name
+	})
+
+	var issueList []scanner.Issue
+	if issues != nil {
+		issueList = issues.Scanner.Issues()
+	}
+
 	s := &savefile{
-		Version:      "v1.2",
+		Version:      "v1.4",
 		Replays:      replays,
 		Proxyentries: proxyentries,
 		WebSocket:    wsEntries,
+		Chains:       chains,
+		Issues:       issueList,
 	}
 
 	var jsonData []byte
@@ -157,7 +176,7 @@ func Save(filename string, replayview *ReplayView, proxy *ProxyView, websocket *
 }
 
 // Load - needs to read a json file, clear out the proxy and replay tables and repopulate them
-func Load(filename string, replayview *ReplayView, prox *ProxyView, sitemap *SiteMapView, websocket *WebSocketView) bool {
+func Load(filename string, replayview *ReplayView, prox *ProxyView, sitemap *SiteMapView, websocket *WebSocketView, issues *IssuesView) bool {
 	f, err := os.Open(filename)
 	if err != nil {
 		log.Println(err)
@@ -178,7 +197,7 @@ func Load(filename string, replayview *ReplayView, prox *ProxyView, sitemap *Sit
 		return false
 	}
 
-	if s.Version == "v1.1" || s.Version == "v1.2" {
+	if s.Version == "v1.1" || s.Version == "v1.2" || s.Version == "v1.3" || s.Version == "v1.4" {
 		replayview.Table.Clear()
 
 		prox.Logger.Reset()
@@ -205,8 +224,15 @@ func Load(filename string, replayview *ReplayView, prox *ProxyView, sitemap *Sit
 			replayview.LoadReplays(&rr)
 		}
 
-		// v1.2 has websocket data
-		if s.Version == "v1.2" {
+		// v1.3 has request chains
+		replayview.chains = make(map[string]*replay.Chain)
+		replayview.chain = ""
+		for i := range s.Chains {
+			replayview.chains[s.Chains[i].Name] = &s.Chains[i]
+		}
+
+		// v1.2 and up has websocket data
+		if s.Version != "v1.1" {
 			// restore websocket entries
 			if websocket != nil && len(s.WebSocket) > 0 {
 				prox.Logger.ResetWSEntries()
@@ -218,6 +244,12 @@ func Load(filename string, replayview *ReplayView, prox *ProxyView, sitemap *Sit
 			}
 		}
 
+		// v1.4 has scanner issues, older files clear them along with the entries they point at
+		if issues != nil {
+			issues.Scanner.Load(s.Issues)
+			issues.Reload()
+		}
+
 		return true
 	}
 	if s.Version == "" {
@@ -244,6 +276,11 @@ func Load(filename string, replayview *ReplayView, prox *ProxyView, sitemap *Sit
 			replayview.AddItem(&ls.Replays[i])
 		}
 
+		if issues != nil {
+			issues.Scanner.Load(nil)
+			issues.Reload()
+		}
+
 		return true
 	}
 	log.Printf("[!] Unknown save file version")
@@ -34,7 +34,7 @@ func initializeTestApp() (*tview.Application, *ProxyView, *SiteMapView, *ReplayV
 
 	// save view
 	saveview := new(SaveRestoreView)
-	saveview.Init(app, replayview, proxyview, sitemapview, nil)
+	saveview.Init(app, replayview, proxyview, sitemapview, nil, nil)
 
 	return app, proxyview, sitemapview, replayview, saveview
 }